@@ -0,0 +1,161 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Circuit breaker limits a backend can hit, also used as reasons when it is
+// skipped.
+const (
+	LimitConnections = "max_connections"
+	LimitPending     = "max_pending"
+	LimitConnectRate = "max_connects_per_sec"
+)
+
+// Limits are the circuit breaker thresholds of a backend. Zero means
+// unlimited.
+type Limits struct {
+	MaxConnections    int64 // connections or requests in flight
+	MaxPending        int64 // dials in progress
+	MaxConnectsPerSec int64 // dials started within the current second
+}
+
+// ErrOverflow is returned when a circuit breaker limit refuses a dial.
+var ErrOverflow = errors.New("circuit breaker limit reached")
+
+// Overflows counts how often a backend refused a connection for each limit.
+type Overflows struct {
+	Connections int64
+	Pending     int64
+	ConnectRate int64
+}
+
+func WithLimits(l Limits) Option {
+	return func(b *Backend) {
+		b.SetLimits(l)
+	}
+}
+
+func (b *Backend) SetLimits(l Limits) {
+	atomic.StoreInt64(&b.maxConns, l.MaxConnections)
+	atomic.StoreInt64(&b.maxPending, l.MaxPending)
+	atomic.StoreInt64(&b.maxConnectRate, l.MaxConnectsPerSec)
+}
+
+func (b *Backend) Limits() Limits {
+	return Limits{
+		MaxConnections:    atomic.LoadInt64(&b.maxConns),
+		MaxPending:        atomic.LoadInt64(&b.maxPending),
+		MaxConnectsPerSec: atomic.LoadInt64(&b.maxConnectRate),
+	}
+}
+
+// Saturated returns the limit that keeps the backend from taking another
+// connection, or "" if there is none. It only looks, AcquireConn and
+// BeginConnect are what take the slots.
+func (b *Backend) Saturated() string {
+	if limit := atomic.LoadInt64(&b.maxConns); limit > 0 && b.ConnCount() >= limit {
+		return LimitConnections
+	}
+	if limit := atomic.LoadInt64(&b.maxPending); limit > 0 && atomic.LoadInt64(&b.pending) >= limit {
+		return LimitPending
+	}
+	if limit := atomic.LoadInt64(&b.maxConnectRate); limit > 0 && b.connectsThisSecond() >= limit {
+		return LimitConnectRate
+	}
+	return ""
+}
+
+// AcquireConn counts a connection to the backend like IncConn unless it is
+// at max_connections, reporting whether it did.
+func (b *Backend) AcquireConn() bool {
+	limit := atomic.LoadInt64(&b.maxConns)
+	for {
+		n := atomic.LoadInt64(&b.connCount)
+		if limit > 0 && n&^connCounted >= limit {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.connCount, n, n+1) {
+			if n&connCounted != 0 {
+				b.tierConns.Add(1)
+			}
+			return true
+		}
+	}
+}
+
+// AddOverflow counts a connection refused by limit.
+func (b *Backend) AddOverflow(limit string) {
+	switch limit {
+	case LimitConnections:
+		atomic.AddInt64(&b.overflows.Connections, 1)
+	case LimitPending:
+		atomic.AddInt64(&b.overflows.Pending, 1)
+	case LimitConnectRate:
+		atomic.AddInt64(&b.overflows.ConnectRate, 1)
+	}
+}
+
+func (b *Backend) Overflows() Overflows {
+	return Overflows{
+		Connections: atomic.LoadInt64(&b.overflows.Connections),
+		Pending:     atomic.LoadInt64(&b.overflows.Pending),
+		ConnectRate: atomic.LoadInt64(&b.overflows.ConnectRate),
+	}
+}
+
+// BeginConnect counts a dial to the backend until EndConnect is called. A
+// dial that would go over max_pending or max_connects_per_sec is refused
+// with ErrOverflow and counted as an overflow, and must not be ended.
+func (b *Backend) BeginConnect() error {
+	limit := atomic.LoadInt64(&b.maxPending)
+	for {
+		n := atomic.LoadInt64(&b.pending)
+		if limit > 0 && n >= limit {
+			return b.refuse(LimitPending)
+		}
+		if atomic.CompareAndSwapInt64(&b.pending, n, n+1) {
+			break
+		}
+	}
+
+	now := time.Now().Unix()
+	b.mu.Lock()
+	if b.connectSecond != now {
+		b.connectSecond = now
+		b.connects = 0
+	}
+	if limit := atomic.LoadInt64(&b.maxConnectRate); limit > 0 && b.connects >= limit {
+		b.mu.Unlock()
+		atomic.AddInt64(&b.pending, -1)
+		return b.refuse(LimitConnectRate)
+	}
+	b.connects++
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *Backend) refuse(limit string) error {
+	b.AddOverflow(limit)
+	return fmt.Errorf("%w: %s", ErrOverflow, limit)
+}
+
+func (b *Backend) EndConnect() {
+	atomic.AddInt64(&b.pending, -1)
+}
+
+func (b *Backend) Pending() int64 {
+	return atomic.LoadInt64(&b.pending)
+}
+
+func (b *Backend) connectsThisSecond() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.connectSecond != time.Now().Unix() {
+		return 0
+	}
+	return b.connects
+}
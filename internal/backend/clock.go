@@ -0,0 +1,22 @@
+package backend
+
+import "time"
+
+// Clock tells a pool and its backends the time for slow start and latency
+// decay. Pools use time.Now unless given another one, which lets tests step
+// through those windows.
+type Clock func() time.Time
+
+// SetClock makes the pool and its backends read the time from c.
+func (p *Pool) SetClock(c Clock) {
+	p.clock.Store(&c)
+}
+
+func (b *Backend) now() time.Time {
+	if b.clock != nil {
+		if c := b.clock.Load(); c != nil {
+			return (*c)()
+		}
+	}
+	return time.Now()
+}
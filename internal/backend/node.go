@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,18 +13,71 @@ type Backend struct {
 	mu      sync.RWMutex
 
 	alive               int32 // 1=UP 0=DOWN
-	connCount           int64
+	ejected             int32 // 1 while outlier detection keeps it out of rotation
+	connCount           int64 // open connections, with connCounted while they count toward the tier
 	consecutiveFailures int32
 	consecutiveSuccess  int32
 	lastFailed          time.Time
 	lastSuccess         time.Time
+
+	bytesSent     int64 // proxied client -> backend
+	bytesReceived int64 // proxied backend -> client
+
+	grpcStatus [GRPCStatusCodes]int64 // completed gRPC calls by grpc-status
+	retries    int64                  // requests retried elsewhere after failing here
+
+	latency   uint64 // peak-EWMA of connect time or time to first byte, float64 nanos
+	latencyAt int64  // unix nanos of the last latency observation
+
+	outlier OutlierStats
+
+	proxyProtocol string        // PROXY header version sent on connect, empty = frontend default
+	priority      int           // tier, lower is preferred; fixed once added to a pool
+	tierConns     *atomic.Int64 // owning pool's open connection count for the tier
+	removed       int32         // 1 once taken out of its pool
+
+	// Circuit breaker limits, 0 = unlimited, and how often each was hit
+	maxConns       int64
+	maxPending     int64
+	maxConnectRate int64
+	overflows      Overflows
+	pending        int64 // dials in progress
+	connectSecond  int64 // unix second connects counts dials for, under mu
+	connects       int64
+
+	generation *atomic.Uint64 // owning pool's, bumped when alive or weight change
+
+	slowStart    *atomic.Pointer[SlowStart] // owning pool's
+	warmingSince int64                      // unix nanos the slow-start window began, 0 once warm
+
+	clock *atomic.Pointer[Clock] // owning pool's
+}
+
+// GRPCStatusCodes is the number of canonical gRPC status codes, OK (0)
+// through UNAUTHENTICATED (16).
+const GRPCStatusCodes = 17
+
+// LatencyDecay is how long it takes a latency observation to fade to 1/e
+// of its weight in the peak-EWMA.
+const LatencyDecay = 10 * time.Second
+
+// Option customises a Backend when it is created.
+type Option func(*Backend)
+
+func WithProxyProtocol(version string) Option {
+	return func(b *Backend) {
+		b.proxyProtocol = version
+	}
 }
 
-func NewBackend(address string, weight int64) *Backend {
+func NewBackend(address string, weight int64, opts ...Option) *Backend {
 	b := &Backend{
 		Address: address,
 		weight:  weight,
 	}
+	for _, opt := range opts {
+		opt(b)
+	}
 
 	// Backend is considered healthy by default until marked by health checker
 	atomic.StoreInt32(&b.alive, 1)
@@ -35,7 +89,13 @@ func (b *Backend) GetWeight() int64 {
 }
 
 func (b *Backend) SetWeight(weight int64) {
-	atomic.StoreInt64(&b.weight, weight)
+	if atomic.SwapInt64(&b.weight, weight) != weight {
+		b.changed()
+	}
+}
+
+func (b *Backend) ProxyProtocol() string {
+	return b.proxyProtocol
 }
 
 func (b *Backend) IsAlive() bool {
@@ -43,7 +103,10 @@ func (b *Backend) IsAlive() bool {
 }
 
 func (b *Backend) MarkAlive() {
-	atomic.StoreInt32(&b.alive, 1)
+	if atomic.SwapInt32(&b.alive, 1) != 1 {
+		b.warmUp()
+		b.changed()
+	}
 	atomic.StoreInt32(&b.consecutiveFailures, 0)
 	atomic.AddInt32(&b.consecutiveSuccess, 1)
 	b.mu.Lock()
@@ -52,7 +115,9 @@ func (b *Backend) MarkAlive() {
 }
 
 func (b *Backend) MarkDead() {
-	atomic.StoreInt32(&b.alive, 0)
+	if atomic.SwapInt32(&b.alive, 0) != 0 {
+		b.changed()
+	}
 	atomic.StoreInt32(&b.consecutiveSuccess, 0)
 	atomic.AddInt32(&b.consecutiveFailures, 1)
 	b.mu.Lock()
@@ -60,16 +125,133 @@ func (b *Backend) MarkDead() {
 	b.lastFailed = time.Now()
 }
 
+// Eject takes the backend out of rotation without marking it dead, so
+// active health checks cannot bring it back early.
+func (b *Backend) Eject() {
+	if atomic.SwapInt32(&b.ejected, 1) != 1 {
+		b.changed()
+	}
+}
+
+// Readmit ends an ejection, starting a new slow-start window.
+func (b *Backend) Readmit() {
+	if atomic.SwapInt32(&b.ejected, 0) != 0 {
+		b.warmUp()
+		b.changed()
+	}
+}
+
+func (b *Backend) IsEjected() bool {
+	return atomic.LoadInt32(&b.ejected) == 1
+}
+
+// Available reports whether the backend may be picked: alive and not
+// ejected.
+func (b *Backend) Available() bool {
+	return b.IsAlive() && !b.IsEjected()
+}
+
+// changed tells the owning pool that its alive set or weights are different
+// now.
+func (b *Backend) changed() {
+	if b.generation != nil {
+		b.generation.Add(1)
+	}
+	b.recount()
+}
+
 func (b *Backend) IncConn() {
-	atomic.AddInt64(&b.connCount, 1)
+	if atomic.AddInt64(&b.connCount, 1)&connCounted != 0 {
+		b.tierConns.Add(1)
+	}
 }
 
 func (b *Backend) DecConn() {
-	atomic.AddInt64(&b.connCount, -1)
+	if atomic.AddInt64(&b.connCount, -1)&connCounted != 0 {
+		b.tierConns.Add(-1)
+	}
 }
 
 func (b *Backend) ConnCount() int64 {
-	return atomic.LoadInt64(&b.connCount)
+	return atomic.LoadInt64(&b.connCount) &^ connCounted
+}
+
+func (b *Backend) AddTraffic(sent, received int64) {
+	atomic.AddInt64(&b.bytesSent, sent)
+	atomic.AddInt64(&b.bytesReceived, received)
+}
+
+func (b *Backend) BytesSent() int64 {
+	return atomic.LoadInt64(&b.bytesSent)
+}
+
+func (b *Backend) BytesReceived() int64 {
+	return atomic.LoadInt64(&b.bytesReceived)
+}
+
+// ObserveLatency folds rtt into the backend's peak-EWMA latency. Spikes
+// are taken at once, improvements only decay in over LatencyDecay.
+func (b *Backend) ObserveLatency(rtt time.Duration) {
+	now := b.now().UnixNano()
+	for {
+		old := atomic.LoadUint64(&b.latency)
+		prev := math.Float64frombits(old)
+		next := float64(rtt)
+		if prev > 0 && next < prev {
+			elapsed := max(now-atomic.LoadInt64(&b.latencyAt), 0)
+			w := math.Exp(-float64(elapsed) / float64(LatencyDecay))
+			next = prev*w + next*(1-w)
+		}
+		if atomic.CompareAndSwapUint64(&b.latency, old, math.Float64bits(next)) {
+			atomic.StoreInt64(&b.latencyAt, now)
+			return
+		}
+	}
+}
+
+// Latency returns the peak-EWMA latency, 0 until the first observation.
+func (b *Backend) Latency() time.Duration {
+	return time.Duration(math.Float64frombits(atomic.LoadUint64(&b.latency)))
+}
+
+// DecayedLatency is Latency faded toward zero over LatencyDecay for the
+// time since the last observation, as if that time had brought samples of
+// zero. A backend that spiked and then got no traffic to report on is
+// thereby tried again instead of being avoided for good.
+func (b *Backend) DecayedLatency() time.Duration {
+	latency := math.Float64frombits(atomic.LoadUint64(&b.latency))
+	if latency == 0 {
+		return 0
+	}
+	elapsed := max(b.now().UnixNano()-atomic.LoadInt64(&b.latencyAt), 0)
+	return time.Duration(latency * math.Exp(-float64(elapsed)/float64(LatencyDecay)))
+}
+
+func (b *Backend) AddRetry() {
+	atomic.AddInt64(&b.retries, 1)
+}
+
+func (b *Backend) Retries() int64 {
+	return atomic.LoadInt64(&b.retries)
+}
+
+// AddGRPCStatus counts a gRPC call that finished with code. Codes outside
+// the canonical range are counted as UNKNOWN (2).
+func (b *Backend) AddGRPCStatus(code int) {
+	if code < 0 || code >= GRPCStatusCodes {
+		code = 2
+	}
+	atomic.AddInt64(&b.grpcStatus[code], 1)
+}
+
+// GRPCStatus returns the number of gRPC calls that finished with each
+// status code, indexed by code.
+func (b *Backend) GRPCStatus() [GRPCStatusCodes]int64 {
+	var counts [GRPCStatusCodes]int64
+	for i := range counts {
+		counts[i] = atomic.LoadInt64(&b.grpcStatus[i])
+	}
+	return counts
 }
 
 func (b *Backend) GetLastSuccess() time.Time {
@@ -88,6 +270,10 @@ func (b *Backend) AddFailures() int32 {
 	return atomic.AddInt32(&b.consecutiveFailures, 1)
 }
 
+func (b *Backend) Failures() int32 {
+	return atomic.LoadInt32(&b.consecutiveFailures)
+}
+
 func (b *Backend) ResetFailures() {
 	atomic.StoreInt32(&b.consecutiveFailures, 0)
 }
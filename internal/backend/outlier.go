@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// OutlierStats are what passive outlier detection tracks of a backend's
+// proxied connections. Every connection updates them, so they are atomics
+// rather than state behind the detector's lock.
+type OutlierStats struct {
+	ConnectFailures atomic.Int64 // dials failed in a row
+	Resets          atomic.Int64 // early resets by the backend in a row
+	Samples         atomic.Int64 // connect latency samples since the last reset
+
+	latency atomic.Uint64 // EWMA of connect time, float64 nanos, 0 = no sample
+}
+
+// Outlier returns the backend's outlier detection counters.
+func (b *Backend) Outlier() *OutlierStats {
+	return &b.outlier
+}
+
+// ObserveLatency folds rtt into the connect latency EWMA with weight alpha,
+// or starts it from rtt on the first sample.
+func (s *OutlierStats) ObserveLatency(rtt time.Duration, alpha float64) {
+	for {
+		old := s.latency.Load()
+		next := float64(rtt)
+		if old != 0 {
+			prev := math.Float64frombits(old)
+			next = prev + alpha*(next-prev)
+		}
+		if s.latency.CompareAndSwap(old, math.Float64bits(next)) {
+			s.Samples.Add(1)
+			return
+		}
+	}
+}
+
+// Latency returns the connect latency EWMA in nanos.
+func (s *OutlierStats) Latency() float64 {
+	return math.Float64frombits(s.latency.Load())
+}
+
+// Reset clears every counter, so the backend is measured afresh.
+func (s *OutlierStats) Reset() {
+	s.ConnectFailures.Store(0)
+	s.Resets.Store(0)
+	s.Samples.Store(0)
+	s.latency.Store(0)
+}
@@ -2,13 +2,29 @@ package backend
 
 import (
 	"errors"
+	"math/rand/v2"
 	"sync"
+	"sync/atomic"
 )
 
 type Pool struct {
 	mu       sync.RWMutex
 	backends []*Backend
 	index    map[string]*Backend
+
+	// Bumped whenever a backend is added or removed, goes up or down or
+	// changes weight
+	generation atomic.Uint64
+
+	slowStart atomic.Pointer[SlowStart]
+	clock     atomic.Pointer[Clock]
+
+	overprovisioning atomic.Pointer[float64]
+	plan             atomic.Pointer[tierPlan] // cached by generation
+
+	// Open connections by priority tier, replaced under mu when a tier is
+	// first seen so picks can read it without locking
+	tierConns atomic.Pointer[map[int]*atomic.Int64]
 }
 
 func NewPool() *Pool {
@@ -18,7 +34,7 @@ func NewPool() *Pool {
 	}
 }
 
-func (p *Pool) AddBackend(address string, weight int64) (*Backend, error) {
+func (p *Pool) AddBackend(address string, weight int64, opts ...Option) (*Backend, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
@@ -26,9 +42,16 @@ func (p *Pool) AddBackend(address string, weight int64) (*Backend, error) {
 		return nil, errors.New("backend already exists")
 	}
 
-	b := NewBackend(address, weight)
+	b := NewBackend(address, weight, opts...)
+	b.generation = &p.generation
+	b.slowStart = &p.slowStart
+	b.clock = &p.clock
+	b.tierConns = p.tierCounter(b.priority)
+	b.recount()
+	b.warmUp()
 	p.backends = append(p.backends, b)
 	p.index[address] = b
+	p.generation.Add(1)
 	return b, nil
 }
 
@@ -44,14 +67,23 @@ func (p *Pool) RemoveBackend(address string) bool {
 	newBackends := make([]*Backend, 0, len(p.backends)-1)
 	for _, b := range p.backends {
 		if b.Address == address {
+			atomic.StoreInt32(&b.removed, 1)
+			b.recount()
 			continue
 		}
 		newBackends = append(newBackends, b)
 	}
 	p.backends = newBackends
+	p.generation.Add(1)
 	return true
 }
 
+// Generation changes whenever the membership, alive set or weights of the
+// pool do, so balancers can cache what they derive from it.
+func (p *Pool) Generation() uint64 {
+	return p.generation.Load()
+}
+
 func (p *Pool) GetBackends() []*Backend {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -121,12 +153,25 @@ func (p *Pool) MarkDead(address string) error {
 	return nil
 }
 
+// Random returns a uniformly chosen backend, alive or not, without copying
+// the pool. It returns nil if the pool is empty.
+func (p *Pool) Random() *Backend {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.backends) == 0 {
+		return nil
+	}
+	return p.backends[rand.IntN(len(p.backends))]
+}
+
+// AliveSnapshot returns the backends that may be picked, alive and not
+// ejected.
 func (p *Pool) AliveSnapshot() []*Backend {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	out := make([]*Backend, 0, len(p.backends))
 	for _, b := range p.backends {
-		if b.IsAlive() {
+		if b.Available() {
 			out = append(out, b)
 		}
 	}
@@ -1,9 +1,14 @@
 package backend
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNewPool(t *testing.T) {
@@ -279,3 +284,351 @@ func TestPoolEdgeCases(t *testing.T) {
 		t.Error("RemoveBackend on empty pool should return false")
 	}
 }
+
+func TestBackendTraffic(t *testing.T) {
+	b := NewBackend("10.0.0.1:8080", 1)
+
+	b.AddTraffic(100, 250)
+	b.AddTraffic(50, 0)
+
+	if b.BytesSent() != 150 {
+		t.Errorf("Expected 150 bytes sent, got %d", b.BytesSent())
+	}
+	if b.BytesReceived() != 250 {
+		t.Errorf("Expected 250 bytes received, got %d", b.BytesReceived())
+	}
+}
+
+func TestObserveLatency(t *testing.T) {
+	b := NewBackend("10.0.0.1:8080", 1)
+	if b.Latency() != 0 {
+		t.Errorf("Expected no latency before observations, got %v", b.Latency())
+	}
+
+	b.ObserveLatency(10 * time.Millisecond)
+	b.ObserveLatency(50 * time.Millisecond)
+	if b.Latency() != 50*time.Millisecond {
+		t.Errorf("Expected a spike to be taken at once, got %v", b.Latency())
+	}
+
+	// Back to back, a faster sample barely moves the peak
+	b.ObserveLatency(time.Millisecond)
+	if got := b.Latency(); got < 49*time.Millisecond || got >= 50*time.Millisecond {
+		t.Errorf("Expected the improvement to decay in slowly, got %v", got)
+	}
+}
+
+func TestDecayedLatency(t *testing.T) {
+	now := time.Now()
+	pool := NewPool()
+	pool.SetClock(func() time.Time { return now })
+	b, _ := pool.AddBackend("10.0.0.1:8080", 1)
+
+	if b.DecayedLatency() != 0 {
+		t.Errorf("Expected no latency before observations, got %v", b.DecayedLatency())
+	}
+
+	b.ObserveLatency(100 * time.Millisecond)
+	if b.DecayedLatency() != 100*time.Millisecond {
+		t.Errorf("Expected a fresh observation undecayed, got %v", b.DecayedLatency())
+	}
+
+	// Without new samples the latency fades to 1/e per LatencyDecay
+	now = now.Add(LatencyDecay)
+	if got := b.DecayedLatency(); got < 36*time.Millisecond || got > 37*time.Millisecond {
+		t.Errorf("Expected about 36.8ms after one decay window, got %v", got)
+	}
+	if b.Latency() != 100*time.Millisecond {
+		t.Errorf("Expected the stored peak to be left alone, got %v", b.Latency())
+	}
+}
+
+func TestSlowStart(t *testing.T) {
+	now := time.Now()
+	pool := NewPool()
+	pool.SetClock(func() time.Time { return now })
+	pool.SetSlowStart(SlowStart{Window: 100 * time.Millisecond, Aggression: 1, MinPercent: 10})
+	b, _ := pool.AddBackend("10.0.0.1:8080", 4)
+
+	if f := b.SlowStartFactor(); f != 0.1 {
+		t.Errorf("Expected a new backend to start at 10%%, got %.2f", f)
+	}
+	if w := b.EffectiveWeight(); w != 0.4 {
+		t.Errorf("Expected effective weight 0.4, got %.2f", w)
+	}
+
+	now = now.Add(50 * time.Millisecond)
+	if f := b.SlowStartFactor(); f != 0.5 {
+		t.Errorf("Expected half weight halfway through the window, got %.2f", f)
+	}
+
+	now = now.Add(50 * time.Millisecond)
+	if f := b.SlowStartFactor(); f != 1 {
+		t.Errorf("Expected full weight after the window, got %.2f", f)
+	}
+
+	// Coming back alive starts a new window, staying alive does not
+	b.MarkAlive()
+	if f := b.SlowStartFactor(); f != 1 {
+		t.Errorf("Expected an alive backend to stay warm, got %.2f", f)
+	}
+	b.MarkDead()
+	b.MarkAlive()
+	if f := b.SlowStartFactor(); f != 0.1 {
+		t.Errorf("Expected a recovered backend to ramp up again, got %.2f", f)
+	}
+
+	// Without slow start backends get their full weight at once
+	plain, _ := NewPool().AddBackend("10.0.0.2:8080", 4)
+	if w := plain.EffectiveWeight(); w != 4 {
+		t.Errorf("Expected effective weight 4, got %.2f", w)
+	}
+}
+
+func TestEject(t *testing.T) {
+	pool := NewPool()
+	pool.SetSlowStart(SlowStart{Window: time.Minute, Aggression: 1, MinPercent: 10})
+	b, _ := pool.AddBackend("10.0.0.1:8080", 1)
+	_, _ = pool.AddBackend("10.0.0.2:8080", 1)
+	b.warmingSince = 0
+
+	gen := pool.Generation()
+	b.Eject()
+	if !b.IsAlive() || b.Available() {
+		t.Error("Expected an ejected backend to stay alive but be unavailable")
+	}
+	if len(pool.AliveSnapshot()) != 1 {
+		t.Errorf("Expected 1 backend in the snapshot, got %d", len(pool.AliveSnapshot()))
+	}
+	if pool.Generation() == gen {
+		t.Error("Expected ejecting to bump the generation")
+	}
+
+	// Readmitted backends warm up again
+	b.Readmit()
+	if !b.Available() || len(pool.AliveSnapshot()) != 2 {
+		t.Error("Expected the readmitted backend back in the snapshot")
+	}
+	if f := b.SlowStartFactor(); f >= 1 {
+		t.Errorf("Expected a readmitted backend to be in slow start, got %.2f", f)
+	}
+}
+
+func TestCircuitBreakerLimits(t *testing.T) {
+	b := NewBackend("10.0.0.1:8080", 1, WithLimits(Limits{MaxConnections: 2, MaxPending: 1, MaxConnectsPerSec: 3}))
+
+	tests := []struct {
+		name string
+		do   func()
+		want string
+	}{
+		{"idle", func() {}, ""},
+		{"one pending", func() {
+			if err := b.BeginConnect(); err != nil {
+				t.Fatalf("Expected the first dial to be let through, got %v", err)
+			}
+			if err := b.BeginConnect(); !errors.Is(err, ErrOverflow) {
+				t.Errorf("Expected ErrOverflow for a second dial, got %v", err)
+			}
+		}, LimitPending},
+		{"connected", func() { b.EndConnect(); b.AcquireConn() }, ""},
+		{"at max connections", func() {
+			b.AcquireConn()
+			if b.AcquireConn() {
+				t.Error("Expected a connection over the limit to be refused")
+			}
+		}, LimitConnections},
+		{"below max connections", func() { b.DecConn(); b.DecConn() }, ""},
+		{"connect rate", func() {
+			for range 2 {
+				if err := b.BeginConnect(); err != nil {
+					t.Fatalf("Expected dials within the rate to be let through, got %v", err)
+				}
+				b.EndConnect()
+			}
+			if err := b.BeginConnect(); !errors.Is(err, ErrOverflow) {
+				t.Errorf("Expected ErrOverflow over the connect rate, got %v", err)
+			}
+		}, LimitConnectRate},
+	}
+	for _, tt := range tests {
+		tt.do()
+		if got := b.Saturated(); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+	if b.ConnCount() != 0 || b.Pending() != 0 {
+		t.Errorf("Expected refusals to hold no slots, got %d connections and %d pending", b.ConnCount(), b.Pending())
+	}
+
+	// Looking is free, refused dials are overflows
+	want := Overflows{Pending: 1, ConnectRate: 1}
+	if got := b.Overflows(); got != want {
+		t.Errorf("Expected overflows %+v, got %+v", want, got)
+	}
+
+	// Lifting the limits frees the backend
+	b.SetLimits(Limits{})
+	if got := b.Saturated(); got != "" {
+		t.Errorf("Expected no limit, got %q", got)
+	}
+}
+
+func TestCircuitBreakerConcurrent(t *testing.T) {
+	b := NewBackend("10.0.0.1:8080", 1, WithLimits(Limits{MaxConnections: 5, MaxPending: 3}))
+
+	var conns, dials atomic.Int64
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.AcquireConn() {
+				conns.Add(1)
+			}
+			if b.BeginConnect() == nil {
+				dials.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if conns.Load() != 5 || b.ConnCount() != 5 {
+		t.Errorf("Expected 5 connections, got %d taken and %d counted", conns.Load(), b.ConnCount())
+	}
+	if dials.Load() != 3 || b.Pending() != 3 {
+		t.Errorf("Expected 3 dials, got %d begun and %d pending", dials.Load(), b.Pending())
+	}
+	if got := b.Overflows().Pending; got != 97 {
+		t.Errorf("Expected 97 pending overflows, got %d", got)
+	}
+}
+
+func TestPriorityTiers(t *testing.T) {
+	pool := NewPool()
+	var primaries []*Backend
+	for i := range 4 {
+		b, _ := pool.AddBackend(fmt.Sprintf("10.0.0.%d:8080", i+1), 1)
+		primaries = append(primaries, b)
+	}
+	backup, _ := pool.AddBackend("10.0.1.1:8080", 1, WithPriority(1))
+	_, _ = pool.AddBackend("10.0.1.2:8080", 1, WithPriority(1))
+
+	tests := []struct {
+		name   string
+		factor float64
+		dead   int // primaries down
+		want   []float64
+	}{
+		{"strict, all up", 0, 0, []float64{1, 0}},
+		{"strict, one primary left", 0, 3, []float64{1, 0}},
+		{"overprovisioned, all up", 1.4, 0, []float64{1, 0}},
+		{"overprovisioned, above the threshold", 1.4, 1, []float64{1, 0}},
+		{"overprovisioned, half down", 1.4, 2, []float64{0.7, 0.3}},
+		{"overprovisioned, no primaries", 1.4, 4, []float64{1}},
+	}
+	for _, tt := range tests {
+		pool.SetOverprovisioning(tt.factor)
+		for i, b := range primaries {
+			if i < tt.dead {
+				b.MarkDead()
+			} else {
+				b.MarkAlive()
+			}
+		}
+
+		plan := pool.tiers()
+		if len(plan.loads) != len(tt.want) {
+			t.Errorf("%s: expected loads %v, got %v", tt.name, tt.want, plan.loads)
+			continue
+		}
+		for i := range tt.want {
+			if math.Abs(plan.loads[i]-tt.want[i]) > 1e-9 {
+				t.Errorf("%s: expected loads %v, got %v", tt.name, tt.want, plan.loads)
+				break
+			}
+		}
+	}
+
+	// Half the primaries down: draws past their 70% go to the backups first
+	pool.SetOverprovisioning(1.4)
+	primaries[0].MarkAlive()
+	primaries[1].MarkAlive()
+	if got := pool.Failover(0.69); !slices.Equal(got, []int{0, 1}) {
+		t.Errorf("Expected order [0 1], got %v", got)
+	}
+	if got := pool.Failover(0.71); !slices.Equal(got, []int{1, 0}) {
+		t.Errorf("Expected order [1 0], got %v", got)
+	}
+
+	// Both tiers degraded: shares are scaled up to add to 1
+	pool.SetOverprovisioning(1)
+	primaries[1].MarkDead()
+	backup.MarkDead()
+	plan := pool.tiers()
+	if math.Abs(plan.loads[0]-1.0/3) > 1e-9 || math.Abs(plan.loads[1]-2.0/3) > 1e-9 {
+		t.Errorf("Expected loads [1/3 2/3], got %v", plan.loads)
+	}
+
+	// Strict failover keeps backups out of rotation while a primary is up
+	pool.SetOverprovisioning(0)
+	if pool.TierActive(1) {
+		t.Error("Expected the backup tier to get no traffic")
+	}
+	primaries[0].MarkDead()
+	if !pool.TierActive(1) || pool.TierActive(0) {
+		t.Error("Expected only the backup tier to get traffic")
+	}
+}
+
+func TestTierConnCount(t *testing.T) {
+	pool := NewPool()
+	a, _ := pool.AddBackend("10.0.0.1:8080", 1)
+	b, _ := pool.AddBackend("10.0.0.2:8080", 1)
+	backup, _ := pool.AddBackend("10.0.1.1:8080", 1, WithPriority(1))
+
+	a.IncConn()
+	a.IncConn()
+	b.IncConn()
+	backup.IncConn()
+	if got := pool.TierConnCount(0); got != 3 {
+		t.Errorf("Expected 3 connections in tier 0, got %d", got)
+	}
+	if got := pool.TierConnCount(1); got != 1 {
+		t.Errorf("Expected 1 connection in tier 1, got %d", got)
+	}
+	if got := pool.TierConnCount(2); got != 0 {
+		t.Errorf("Expected no connections in an unknown tier, got %d", got)
+	}
+
+	// Only backends that can be picked count, and their connections come
+	// back when they can again
+	tests := []struct {
+		name   string
+		change func()
+		want   int64
+	}{
+		{"dead", b.MarkDead, 2},
+		{"alive again", b.MarkAlive, 3},
+		{"ejected", a.Eject, 1},
+		{"readmitted", a.Readmit, 3},
+		{"weight 0", func() { a.SetWeight(0) }, 1},
+		{"weighted again", func() { a.SetWeight(1) }, 3},
+		{"closed while dead", func() { b.MarkDead(); b.DecConn(); b.MarkAlive() }, 2},
+		{"removed", func() { pool.RemoveBackend(a.Address) }, 0},
+		{"closed after removal", a.DecConn, 0},
+		{"removed then revived", func() { a.MarkDead(); a.MarkAlive() }, 0},
+	}
+	for _, tt := range tests {
+		tt.change()
+		if got := pool.TierConnCount(0); got != tt.want {
+			t.Errorf("%s: expected %d connections in tier 0, got %d", tt.name, tt.want, got)
+		}
+	}
+	if got := a.ConnCount(); got != 1 {
+		t.Errorf("Expected the removed backend to keep its own count of 1, got %d", got)
+	}
+	if got := pool.TierConnCount(1); got != 1 {
+		t.Errorf("Expected 1 connection in tier 1, got %d", got)
+	}
+}
@@ -0,0 +1,187 @@
+package backend
+
+import (
+	"maps"
+	"slices"
+	"sync/atomic"
+)
+
+// Priority tiers: backends with a lower priority number are preferred, and
+// higher numbers are backups. Each tier takes traffic in proportion to its
+// health, the share of its backends that are available times the pool's
+// overprovisioning factor (capped at 100%), and what the tiers before it
+// leave over goes to the next one. With a factor of 1.4 a primary tier
+// keeps all traffic until fewer than about 71% of its backends are
+// available, then spills over gradually. Without a factor, the first tier
+// with any available backend takes everything. If the tiers add up to less than
+// 100%, their shares are scaled up to fill it.
+
+func WithPriority(priority int) Option {
+	return func(b *Backend) {
+		b.priority = priority
+	}
+}
+
+// Priority is the backend's tier, 0 being the most preferred.
+func (b *Backend) Priority() int {
+	return b.priority
+}
+
+// SetOverprovisioning sets the factor tier health is multiplied by, 0 for
+// strict failover.
+func (p *Pool) SetOverprovisioning(factor float64) {
+	p.overprovisioning.Store(&factor)
+	p.generation.Add(1)
+}
+
+// TierConnCount returns the connections open to backends of tier priority
+// that can be picked, leaving out dead, ejected, weight 0 and removed ones,
+// without walking the tier.
+func (p *Pool) TierConnCount(priority int) int64 {
+	if conns := p.tierConns.Load(); conns != nil {
+		if n, ok := (*conns)[priority]; ok {
+			return n.Load()
+		}
+	}
+	return 0
+}
+
+// connCounted is set in a backend's connCount while its connections count
+// toward its tier. Keeping it in the same word lets IncConn and DecConn see
+// whether to update the tier without racing recount.
+const connCounted = 1 << 62
+
+// recount adds the backend's connections to its tier's count when it
+// becomes pickable and takes them out when it stops being.
+func (b *Backend) recount() {
+	if b.tierConns == nil {
+		return
+	}
+	// Checked again after each change so a state flip racing it is not lost
+	for {
+		counted := b.Available() && b.GetWeight() > 0 && atomic.LoadInt32(&b.removed) == 0
+		n := atomic.LoadInt64(&b.connCount)
+		if (n&connCounted != 0) == counted {
+			return
+		}
+		if !atomic.CompareAndSwapInt64(&b.connCount, n, n^connCounted) {
+			continue
+		}
+		if counted {
+			b.tierConns.Add(n)
+		} else {
+			b.tierConns.Add(-(n &^ connCounted))
+		}
+	}
+}
+
+// tierCounter returns the connection counter of tier priority, creating it
+// on first use. Callers hold p.mu.
+func (p *Pool) tierCounter(priority int) *atomic.Int64 {
+	var conns map[int]*atomic.Int64
+	if current := p.tierConns.Load(); current != nil {
+		if n, ok := (*current)[priority]; ok {
+			return n
+		}
+		conns = maps.Clone(*current)
+	} else {
+		conns = make(map[int]*atomic.Int64)
+	}
+	n := new(atomic.Int64)
+	conns[priority] = n
+	p.tierConns.Store(&conns)
+	return n
+}
+
+// tierPlan is the traffic split between tiers for one pool generation.
+type tierPlan struct {
+	generation uint64
+	priorities []int     // of the tiers with available backends, most preferred first
+	loads      []float64 // share of traffic of each of those tiers, adding up to 1
+}
+
+// Failover returns the priorities a pick should try in order: first the
+// tier draw, in [0, 1), falls on by the tiers' shares of traffic, then the
+// other tiers with available backends, most preferred first. It has at
+// most one entry when only one tier has available backends. The result
+// must not be modified.
+func (p *Pool) Failover(draw float64) []int {
+	plan := p.tiers()
+	if len(plan.priorities) <= 1 {
+		return plan.priorities
+	}
+
+	chosen := -1
+	var cumulative float64
+	for i, load := range plan.loads {
+		if load <= 0 {
+			continue
+		}
+		chosen = i
+		cumulative += load
+		if draw < cumulative {
+			break
+		}
+	}
+	if chosen <= 0 {
+		return plan.priorities
+	}
+
+	order := make([]int, 0, len(plan.priorities))
+	order = append(order, plan.priorities[chosen])
+	order = append(order, plan.priorities[:chosen]...)
+	return append(order, plan.priorities[chosen+1:]...)
+}
+
+// TierActive reports whether tier priority currently gets a share of
+// traffic.
+func (p *Pool) TierActive(priority int) bool {
+	plan := p.tiers()
+	i := slices.Index(plan.priorities, priority)
+	return i >= 0 && plan.loads[i] > 0
+}
+
+// tiers returns the plan for the pool's current generation, working it
+// out if the pool has changed since it was last asked for.
+func (p *Pool) tiers() *tierPlan {
+	gen := p.generation.Load()
+	if plan := p.plan.Load(); plan != nil && plan.generation == gen {
+		return plan
+	}
+
+	total := make(map[int]int)
+	available := make(map[int]int)
+	p.mu.RLock()
+	for _, b := range p.backends {
+		total[b.priority]++
+		if b.Available() {
+			available[b.priority]++
+		}
+	}
+	p.mu.RUnlock()
+
+	var factor float64
+	if f := p.overprovisioning.Load(); f != nil {
+		factor = *f
+	}
+
+	plan := &tierPlan{generation: gen, priorities: slices.Sorted(maps.Keys(available))}
+	remaining := 1.0
+	for _, priority := range plan.priorities {
+		health := 1.0
+		if factor > 0 {
+			health = min(factor*float64(available[priority])/float64(total[priority]), 1)
+		}
+		load := min(health, remaining)
+		plan.loads = append(plan.loads, load)
+		remaining -= load
+	}
+	if used := 1 - remaining; used > 0 && used < 1 {
+		for i := range plan.loads {
+			plan.loads[i] /= used
+		}
+	}
+
+	p.plan.Store(plan)
+	return plan
+}
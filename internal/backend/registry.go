@@ -17,7 +17,7 @@ func NewRegistry(pool *Pool) *registry {
 func (r *registry) Apply(event discovery.Event) {
 	switch event.Type {
 	case discovery.BackendAdd:
-		_, _ = r.pool.AddBackend(event.Address, event.Weight)
+		_, _ = r.pool.AddBackend(event.Address, event.Weight, WithProxyProtocol(event.ProxyProtocol))
 	case discovery.BackendRemove:
 		_ = r.pool.RemoveBackend(event.Address)
 	}
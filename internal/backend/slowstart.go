@@ -0,0 +1,57 @@
+package backend
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// SlowStart ramps up the share of traffic a backend gets after it joins
+// the pool or comes back alive, so cold backends are not hit with a full
+// share at once. Backends present from the start ramp together, which
+// leaves their shares unchanged.
+type SlowStart struct {
+	Window time.Duration // 0 disables slow start
+	// Shape of the ramp, factor = (elapsed / Window) ^ (1 / Aggression):
+	// 1 is linear, higher values ramp faster early on
+	Aggression float64
+	// Lowest factor given at the start of the window, in percent
+	MinPercent float64
+}
+
+// SetSlowStart applies s to every backend of the pool, present and future.
+func (p *Pool) SetSlowStart(s SlowStart) {
+	p.slowStart.Store(&s)
+}
+
+// SlowStartFactor is the fraction of its weight the backend currently
+// gets, below 1 while it is within the pool's slow-start window.
+func (b *Backend) SlowStartFactor() float64 {
+	since := atomic.LoadInt64(&b.warmingSince)
+	if since == 0 || b.slowStart == nil {
+		return 1
+	}
+	s := b.slowStart.Load()
+	if s == nil || s.Window <= 0 {
+		return 1
+	}
+
+	elapsed := b.now().UnixNano() - since
+	if elapsed >= int64(s.Window) {
+		// Warm now, later calls need not look at the clock
+		atomic.CompareAndSwapInt64(&b.warmingSince, since, 0)
+		return 1
+	}
+	factor := math.Pow(float64(max(elapsed, 0))/float64(s.Window), 1/s.Aggression)
+	return min(max(factor, s.MinPercent/100), 1)
+}
+
+// EffectiveWeight is the weight scaled by SlowStartFactor.
+func (b *Backend) EffectiveWeight() float64 {
+	return float64(b.GetWeight()) * b.SlowStartFactor()
+}
+
+// warmUp starts the backend's slow-start window.
+func (b *Backend) warmUp() {
+	atomic.StoreInt64(&b.warmingSince, b.now().UnixNano())
+}
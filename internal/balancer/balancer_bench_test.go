@@ -40,6 +40,46 @@ func BenchmarkIPHash_Pick(b *testing.B) {
 	}
 }
 
+func BenchmarkP2C_Pick(b *testing.B) {
+	for _, count := range benchmarkCounts {
+		b.Run(fmt.Sprintf("%d", count), func(b *testing.B) {
+			benchmarkBalancer_Pick(b, "p2c", count)
+		})
+	}
+}
+
+func BenchmarkPeakEWMA_Pick(b *testing.B) {
+	for _, count := range benchmarkCounts {
+		b.Run(fmt.Sprintf("%d", count), func(b *testing.B) {
+			benchmarkBalancer_Pick(b, "peak_ewma", count)
+		})
+	}
+}
+
+func BenchmarkMaglev_Pick(b *testing.B) {
+	for _, count := range benchmarkCounts {
+		b.Run(fmt.Sprintf("%d", count), func(b *testing.B) {
+			benchmarkBalancer_Pick(b, "maglev", count)
+		})
+	}
+}
+
+func BenchmarkRingHash_Pick(b *testing.B) {
+	for _, count := range benchmarkCounts {
+		b.Run(fmt.Sprintf("%d", count), func(b *testing.B) {
+			benchmarkBalancer_Pick(b, "ring_hash", count)
+		})
+	}
+}
+
+func BenchmarkSmoothWeighted_Pick(b *testing.B) {
+	for _, count := range benchmarkCounts {
+		b.Run(fmt.Sprintf("%d", count), func(b *testing.B) {
+			benchmarkBalancer_Pick(b, "smooth_weighted", count)
+		})
+	}
+}
+
 func benchmarkBalancer_Pick(b *testing.B, algo string, count int) {
 	pool := backend.NewPool()
 	for i := 0; i < count; i++ {
@@ -56,8 +96,21 @@ func benchmarkBalancer_Pick(b *testing.B, algo string, count int) {
 		lb = NewWeightedBalancer(pool)
 	case "ip_hash":
 		lb = NewIPHashBalancer(pool)
+	case "p2c":
+		lb = NewP2CBalancer(pool, true)
+	case "peak_ewma":
+		lb = NewPeakEWMABalancer(pool)
+	case "maglev":
+		lb = NewMaglevBalancer(pool)
+	case "ring_hash":
+		lb = NewRingHashBalancer(pool, 100, 0.25)
+	case "smooth_weighted":
+		lb = NewSmoothWeightedBalancer(pool)
 	}
 
+	// Lookup-table balancers build their table on the first pick
+	_, _ = lb.Pick("192.168.1.1")
+
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
 		_, _ = lb.Pick("192.168.1.1")
@@ -2,8 +2,16 @@ package balancer
 
 import (
 	"LoadBalancer/internal/backend"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestLeastConnections(t *testing.T) {
@@ -101,3 +109,684 @@ func TestIPHash(t *testing.T) {
 	picked3, _ := lb.Pick("192.168.1.2")
 	fmt.Printf("IP 1.1 -> %s, IP 1.2 -> %s\n", picked1.Address, picked3.Address)
 }
+
+func TestP2C(t *testing.T) {
+	tests := []struct {
+		name     string
+		weighted bool
+		// Picks with b1 at 3 connections, then at 8, against b2 at 1
+		want []string
+	}{
+		// b1: (3+1)/4 = 1 beats b2: (1+1)/1 = 2, (8+1)/4 does not
+		{"weighted", true, []string{"10.0.0.1:8080", "10.0.0.2:8080"}},
+		// Plain counts: b2's one connection beats b1's three
+		{"unweighted", false, []string{"10.0.0.2:8080", "10.0.0.2:8080"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := backend.NewPool()
+			b1, _ := pool.AddBackend("10.0.0.1:8080", 4)
+			b2, _ := pool.AddBackend("10.0.0.2:8080", 1)
+			dead, _ := pool.AddBackend("10.0.0.3:8080", 1)
+			dead.MarkDead()
+
+			lb := NewP2CBalancer(pool, tt.weighted)
+
+			for range 3 {
+				b1.IncConn()
+			}
+			b2.IncConn()
+
+			picked, err := lb.Pick("")
+			if err != nil {
+				t.Fatalf("Failed to pick: %v", err)
+			}
+			if picked.Address != tt.want[0] {
+				t.Errorf("Expected %s, got %s", tt.want[0], picked.Address)
+			}
+			picked.DecConn()
+
+			for range 5 {
+				b1.IncConn()
+			}
+			picked, _ = lb.Pick("")
+			if picked.Address != tt.want[1] {
+				t.Errorf("Expected %s once b1 is loaded, got %s", tt.want[1], picked.Address)
+			}
+			picked.DecConn()
+
+			// Weight 0 drains a backend however idle it is
+			b2.SetWeight(0)
+			for range 10 {
+				picked, err := lb.Pick("")
+				if err != nil {
+					t.Fatalf("Failed to pick: %v", err)
+				}
+				if picked != b1 {
+					t.Errorf("Expected the weight 0 backend to be skipped, got %s", picked.Address)
+				}
+				picked.DecConn()
+			}
+		})
+	}
+}
+
+func TestPeakEWMA(t *testing.T) {
+	pool := backend.NewPool()
+	fast, _ := pool.AddBackend("10.0.0.1:8080", 1)
+	slow, _ := pool.AddBackend("10.0.0.2:8080", 1)
+	fast.ObserveLatency(10 * time.Millisecond)
+	slow.ObserveLatency(40 * time.Millisecond)
+
+	lb := NewPeakEWMABalancer(pool)
+
+	// fast costs 10ms * (n+1), slow costs 40ms * 1: fast takes the first
+	// three picks, then 10ms * 4 ties with slow and the first wins
+	for i := 0; i < 4; i++ {
+		picked, err := lb.Pick("")
+		if err != nil {
+			t.Fatalf("Failed to pick: %v", err)
+		}
+		if picked != fast {
+			t.Errorf("Pick %d: expected 10.0.0.1:8080, got %s", i, picked.Address)
+		}
+	}
+	picked, _ := lb.Pick("")
+	if picked != slow {
+		t.Errorf("Expected 10.0.0.2:8080 once fast is loaded, got %s", picked.Address)
+	}
+
+	// A new backend is probed, but only with one request until it reports
+	fresh, _ := pool.AddBackend("10.0.0.3:8080", 1)
+	if picked, _ := lb.Pick(""); picked != fresh {
+		t.Errorf("Expected the unobserved backend to be probed, got %s", picked.Address)
+	}
+	if picked, _ := lb.Pick(""); picked == fresh {
+		t.Error("Expected the unobserved backend to get one request at a time")
+	}
+}
+
+func TestPeakEWMARecovery(t *testing.T) {
+	now := time.Now()
+	pool := backend.NewPool()
+	pool.SetClock(func() time.Time { return now })
+	fast, _ := pool.AddBackend("10.0.0.1:8080", 1)
+	spiked, _ := pool.AddBackend("10.0.0.2:8080", 1)
+	fast.ObserveLatency(10 * time.Millisecond)
+	spiked.ObserveLatency(time.Second)
+
+	lb := NewPeakEWMABalancer(pool)
+
+	// fast costs 10ms * (n+1) and keeps reporting, spiked reports nothing
+	// once it stops getting picked
+	for i := 0; i < 5; i++ {
+		if picked, _ := lb.Pick(""); picked != fast {
+			t.Fatalf("Pick %d: expected 10.0.0.1:8080, got %s", i, picked.Address)
+		}
+	}
+
+	// After the decay window spiked is down to ~7ms while fast, still at
+	// 10ms, costs 60ms with its five connections
+	now = now.Add(5 * backend.LatencyDecay)
+	fast.ObserveLatency(10 * time.Millisecond)
+	if picked, _ := lb.Pick(""); picked != spiked {
+		t.Errorf("Expected the spiked backend to be tried again, got %s", picked.Address)
+	}
+}
+
+// maglevMapping picks a backend for each of keys client IPs.
+func maglevMapping(t *testing.T, lb Balancer, keys int) []string {
+	t.Helper()
+
+	out := make([]string, keys)
+	for i := range out {
+		b, err := lb.Pick(fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff))
+		if err != nil {
+			t.Fatalf("Failed to pick: %v", err)
+		}
+		b.DecConn()
+		out[i] = b.Address
+	}
+	return out
+}
+
+func TestMaglevMinimalDisruption(t *testing.T) {
+	const keys = 20000
+
+	pool := backend.NewPool()
+	for i := 1; i <= 10; i++ {
+		_, _ = pool.AddBackend(fmt.Sprintf("10.0.0.%d:8080", i), 1)
+	}
+	lb := NewMaglevBalancer(pool)
+	before := maglevMapping(t, lb, keys)
+
+	// Every backend gets close to an equal share
+	share := map[string]int{}
+	for _, addr := range before {
+		share[addr]++
+	}
+	for addr, n := range share {
+		if n < keys/10*8/10 || n > keys/10*12/10 {
+			t.Errorf("Expected about %d keys on %s, got %d", keys/10, addr, n)
+		}
+	}
+
+	moved := func(a, b []string, ignore string) (int, int) {
+		movedOther, movedIgnored := 0, 0
+		for i := range a {
+			if a[i] == b[i] {
+				continue
+			}
+			if a[i] == ignore {
+				movedIgnored++
+			} else {
+				movedOther++
+			}
+		}
+		return movedOther, movedIgnored
+	}
+
+	tests := []struct {
+		name   string
+		change func()
+		undo   func()
+		gone   string
+	}{
+		{
+			name:   "remove",
+			change: func() { pool.RemoveBackend("10.0.0.4:8080") },
+			undo:   func() { _, _ = pool.AddBackend("10.0.0.4:8080", 1) },
+			gone:   "10.0.0.4:8080",
+		},
+		{
+			name:   "mark dead",
+			change: func() { _ = pool.MarkDead("10.0.0.7:8080") },
+			undo:   func() { _ = pool.MarkAlive("10.0.0.7:8080") },
+			gone:   "10.0.0.7:8080",
+		},
+		{
+			name:   "add",
+			change: func() { _, _ = pool.AddBackend("10.0.0.11:8080", 1) },
+			undo:   func() { pool.RemoveBackend("10.0.0.11:8080") },
+		},
+	}
+
+	for _, tt := range tests {
+		tt.change()
+		after := maglevMapping(t, lb, keys)
+		movedOther, movedGone := moved(before, after, tt.gone)
+
+		if tt.gone != "" && movedGone != share[tt.gone] {
+			t.Errorf("%s: expected all %d keys of %s to move, got %d", tt.name, share[tt.gone], tt.gone, movedGone)
+		}
+		// Ideal is 0 for a removal and keys/11 for an addition; Maglev
+		// trades a little extra churn for its even spread
+		limit := keys / 100
+		if tt.gone == "" {
+			limit = keys/11 + keys/100
+		}
+		if movedOther > limit {
+			t.Errorf("%s: expected at most %d other keys to move, got %d", tt.name, limit, movedOther)
+		}
+
+		tt.undo()
+		if restored := maglevMapping(t, lb, keys); !slices.Equal(restored, before) {
+			t.Errorf("%s: expected the mapping to return once undone", tt.name)
+		}
+	}
+}
+
+func TestRingHashWeights(t *testing.T) {
+	pool := backend.NewPool()
+	heavy, _ := pool.AddBackend("10.0.0.1:8080", 3)
+	_, _ = pool.AddBackend("10.0.0.2:8080", 1)
+
+	// A huge epsilon turns the load bound off, leaving plain consistent hashing
+	lb := NewRingHashBalancer(pool, 100, 1000)
+	mapping := maglevMapping(t, lb, 20000)
+	if again := maglevMapping(t, lb, 20000); !slices.Equal(again, mapping) {
+		t.Error("Expected the same client to stay on the same backend")
+	}
+
+	onHeavy := 0
+	for _, addr := range mapping {
+		if addr == heavy.Address {
+			onHeavy++
+		}
+	}
+	if onHeavy < 20000*65/100 || onHeavy > 20000*85/100 {
+		t.Errorf("Expected about 75%% of clients on the weight 3 backend, got %d of 20000", onHeavy)
+	}
+}
+
+func TestRingHashBoundedLoad(t *testing.T) {
+	pool := backend.NewPool()
+	for i := 1; i <= 4; i++ {
+		_, _ = pool.AddBackend(fmt.Sprintf("10.0.0.%d:8080", i), 1)
+	}
+	lb := NewRingHashBalancer(pool, 100, 0.25)
+
+	// One hot client keeps its connections open
+	hot := map[string]int{}
+	for i := 0; i < 40; i++ {
+		b, err := lb.Pick("203.0.113.7")
+		if err != nil {
+			t.Fatalf("Failed to pick: %v", err)
+		}
+		hot[b.Address]++
+	}
+
+	// Capacity is ceil(1.25 * (n+1) / 4), so no backend may run far ahead
+	for addr, n := range hot {
+		if n > 13 {
+			t.Errorf("Expected the hot client to spill over, %s holds %d of 40", addr, n)
+		}
+	}
+	if len(hot) < 3 {
+		t.Errorf("Expected the load to spread over the ring, got %v", hot)
+	}
+}
+
+func TestRingHashBoundedLoadAfterFailover(t *testing.T) {
+	pool := backend.NewPool()
+	for i := 1; i <= 4; i++ {
+		_, _ = pool.AddBackend(fmt.Sprintf("10.0.0.%d:8080", i), 1)
+	}
+	lb := NewRingHashBalancer(pool, 100, 0.25)
+
+	// A backend dies with 30 connections still draining, which must not
+	// raise the average the others are bounded by
+	down, _ := pool.GetBackend("10.0.0.1:8080")
+	for i := 0; i < 30; i++ {
+		down.IncConn()
+	}
+	_ = pool.MarkDead(down.Address)
+
+	hot := map[string]int{}
+	for i := 0; i < 30; i++ {
+		b, err := lb.Pick("203.0.113.7")
+		if err != nil {
+			t.Fatalf("Failed to pick: %v", err)
+		}
+		hot[b.Address]++
+	}
+
+	// Capacity is ceil(1.25 * (n+1) / 3) over the 3 backends left
+	for addr, n := range hot {
+		if n > 13 {
+			t.Errorf("Expected the hot client to spill over, %s holds %d of 30", addr, n)
+		}
+	}
+}
+
+func TestSmoothWeighted(t *testing.T) {
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend("a", 5)
+	_, _ = pool.AddBackend("b", 1)
+	_, _ = pool.AddBackend("c", 1)
+
+	lb := NewSmoothWeightedBalancer(pool)
+	sequence := func(n int) string {
+		var out string
+		for i := 0; i < n; i++ {
+			picked, err := lb.Pick("")
+			if err != nil {
+				t.Fatalf("Failed to pick: %v", err)
+			}
+			out += picked.Address
+		}
+		return out
+	}
+
+	// Same interleaving as nginx for weights 5, 1, 1
+	if got := sequence(14); got != "aabacaaaabacaa" {
+		t.Errorf("Expected aabacaaaabacaa, got %s", got)
+	}
+
+	// Runtime weight changes apply from the next round
+	_ = pool.UpdateWeight("a", 1)
+	if got := sequence(6); got != "abcabc" {
+		t.Errorf("Expected abcabc after reweighting, got %s", got)
+	}
+
+	// Dead backends are skipped
+	_ = pool.MarkDead("b")
+	if got := sequence(4); got != "acac" {
+		t.Errorf("Expected acac with b down, got %s", got)
+	}
+}
+
+func TestSticky(t *testing.T) {
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend("10.0.0.1:8080", 1)
+	_, _ = pool.AddBackend("10.0.0.2:8080", 1)
+	_, _ = pool.AddBackend("10.0.0.3:8080", 1)
+
+	lb := NewStickyBalancer(NewRoundRobinBalancer(pool), pool, time.Minute, 2)
+	pick := func(key string) string {
+		picked, err := lb.Pick(key)
+		if err != nil {
+			t.Fatalf("Failed to pick: %v", err)
+		}
+		picked.DecConn()
+		return picked.Address
+	}
+
+	// Round robin would move on, the table keeps the client where it was
+	first := pick("192.168.1.1")
+	for range 5 {
+		if got := pick("192.168.1.1"); got != first {
+			t.Fatalf("Expected %s, got %s", first, got)
+		}
+	}
+
+	// Dead or removed backends fall through to the wrapped balancer
+	_ = pool.MarkDead(first)
+	second := pick("192.168.1.1")
+	if second == first {
+		t.Fatalf("Expected a backend other than dead %s", first)
+	}
+	_ = pool.MarkAlive(first)
+	if got := pick("192.168.1.1"); got != second {
+		t.Errorf("Expected the client to stay on %s after failover, got %s", second, got)
+	}
+	pool.RemoveBackend(second)
+	if got := pick("192.168.1.1"); got == second {
+		t.Errorf("Expected removed %s not to be picked", second)
+	}
+
+	// The least recently used key is dropped once the table is full
+	pick("192.168.1.2")
+	pick("192.168.1.1")
+	pick("192.168.1.3")
+	entries := lb.Entries()
+	if len(entries) != 2 || entries[0].Key != "192.168.1.3" || entries[1].Key != "192.168.1.1" {
+		t.Errorf("Expected entries 192.168.1.3 and 192.168.1.1, got %+v", entries)
+	}
+
+	if !lb.Remove("192.168.1.1") || lb.Remove("192.168.1.1") {
+		t.Error("Expected Remove to report the entry once")
+	}
+	if n := lb.Flush(); n != 1 || len(lb.Entries()) != 0 {
+		t.Errorf("Expected Flush to drop 1 entry and leave none, got %d and %d", n, len(lb.Entries()))
+	}
+}
+
+func TestStickyExpiry(t *testing.T) {
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend("10.0.0.1:8080", 1)
+	_, _ = pool.AddBackend("10.0.0.2:8080", 1)
+
+	lb := NewStickyBalancer(NewRoundRobinBalancer(pool), pool, 20*time.Millisecond, 10)
+	first, _ := lb.Pick("192.168.1.1")
+	time.Sleep(40 * time.Millisecond)
+
+	if len(lb.Entries()) != 0 {
+		t.Errorf("Expected the entry to have expired, got %+v", lb.Entries())
+	}
+	second, _ := lb.Pick("192.168.1.1")
+	if second == first {
+		t.Errorf("Expected an expired entry to be balanced again, got %s twice", first.Address)
+	}
+}
+
+func TestSlowStart(t *testing.T) {
+	tests := map[string]struct {
+		newBalancer func(*backend.Pool) Balancer
+		// Picks out of 200 the cold backend should get at slow-start factor f
+		share func(f float64) float64
+	}{
+		"round_robin": {
+			func(p *backend.Pool) Balancer {
+				rr := NewRoundRobinBalancer(p)
+				rr.random = rand.New(rand.NewPCG(3, 4)).Float64
+				return rr
+			},
+			// Its turns, every other pick, are taken with probability f
+			func(f float64) float64 { return 100 * f },
+		},
+		"least_connections": {
+			func(p *backend.Pool) Balancer { return NewLeastConnectionsBalancer(p) },
+			// Connections settle in proportion to the factors
+			func(f float64) float64 { return 200 * f / (1 + f) },
+		},
+		"weighted": {
+			func(p *backend.Pool) Balancer { return NewWeightedBalancer(p) },
+			func(f float64) float64 { return 200 * f / (1 + f) },
+		},
+	}
+
+	const window = 10 * time.Second
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			prev := 0
+			for _, elapsed := range []time.Duration{0, window / 4, window / 2, window} {
+				now := time.Now()
+				pool := backend.NewPool()
+				pool.SetClock(func() time.Time { return now })
+				pool.SetSlowStart(backend.SlowStart{Window: window, Aggression: 1, MinPercent: 10})
+				_, _ = pool.AddBackend("warm", 1)
+				now = now.Add(window)
+				cold, _ := pool.AddBackend("cold", 1)
+				now = now.Add(elapsed)
+
+				// The factor ramps linearly from the 10% floor to full weight
+				f := max(float64(elapsed)/float64(window), 0.1)
+				if got := cold.SlowStartFactor(); math.Abs(got-f) > 1e-9 {
+					t.Fatalf("After %s: expected factor %.2f, got %.2f", elapsed, f, got)
+				}
+
+				// Connections are left open so least_connections and
+				// weighted see the load build up
+				lb := tt.newBalancer(pool)
+				picks := 0
+				for range 200 {
+					picked, err := lb.Pick("")
+					if err != nil {
+						t.Fatalf("Failed to pick: %v", err)
+					}
+					if picked == cold {
+						picks++
+					}
+				}
+
+				if want := tt.share(f); math.Abs(float64(picks)-want) > 10 {
+					t.Errorf("After %s: expected the cold backend to get about %.0f picks, got %d", elapsed, want, picks)
+				}
+				if picks <= prev {
+					t.Errorf("After %s: expected more than %d picks as the factor ramps, got %d", elapsed, prev, picks)
+				}
+				prev = picks
+			}
+		})
+	}
+}
+
+// algorithms builds every balancer, for tests that must hold for all of them.
+var algorithms = map[string]func(*backend.Pool) Balancer{
+	"round_robin":       func(p *backend.Pool) Balancer { return NewRoundRobinBalancer(p) },
+	"least_connections": func(p *backend.Pool) Balancer { return NewLeastConnectionsBalancer(p) },
+	"weighted":          func(p *backend.Pool) Balancer { return NewWeightedBalancer(p) },
+	"ip_hash":           func(p *backend.Pool) Balancer { return NewIPHashBalancer(p) },
+	"p2c":               func(p *backend.Pool) Balancer { return NewP2CBalancer(p, true) },
+	"peak_ewma":         func(p *backend.Pool) Balancer { return NewPeakEWMABalancer(p) },
+	"maglev":            func(p *backend.Pool) Balancer { return NewMaglevBalancer(p) },
+	"ring_hash":         func(p *backend.Pool) Balancer { return NewRingHashBalancer(p, 100, 0.25) },
+	"smooth_weighted":   func(p *backend.Pool) Balancer { return NewSmoothWeightedBalancer(p) },
+	"sticky": func(p *backend.Pool) Balancer {
+		return NewStickyBalancer(NewRoundRobinBalancer(p), p, time.Minute, 10)
+	},
+}
+
+func TestPickExclude(t *testing.T) {
+	for name, newBalancer := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			pool := backend.NewPool()
+			_, _ = pool.AddBackend("10.0.0.1:8080", 1)
+			_, _ = pool.AddBackend("10.0.0.2:8080", 1)
+			_, _ = pool.AddBackend("10.0.0.3:8080", 1)
+
+			lb := newBalancer(pool)
+
+			for i := 0; i < 10; i++ {
+				picked, err := lb.Pick("192.168.1.1", "10.0.0.1:8080", "10.0.0.3:8080")
+				if err != nil {
+					t.Fatalf("Failed to pick: %v", err)
+				}
+				if picked.Address != "10.0.0.2:8080" {
+					t.Errorf("Expected 10.0.0.2:8080, got %s", picked.Address)
+				}
+			}
+
+			// Excluding everything leaves nothing to pick
+			_, err := lb.Pick("192.168.1.1", "10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080")
+			if err == nil {
+				t.Error("Expected error when every backend is excluded")
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	for name, newBalancer := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			pool := backend.NewPool()
+			full, _ := pool.AddBackend("10.0.0.1:8080", 1, backend.WithLimits(backend.Limits{MaxConnections: 1}))
+			free, _ := pool.AddBackend("10.0.0.2:8080", 1, backend.WithLimits(backend.Limits{MaxPending: 1}))
+			full.IncConn()
+
+			lb := newBalancer(pool)
+			for i := range 10 {
+				picked, err := lb.Pick(fmt.Sprintf("192.168.1.%d", i))
+				if err != nil {
+					t.Fatalf("Failed to pick: %v", err)
+				}
+				if picked != free {
+					t.Errorf("Expected %s, got %s", free.Address, picked.Address)
+				}
+				picked.DecConn()
+			}
+			if got := full.Overflows().Connections; got != 0 {
+				t.Errorf("Expected no overflows while another backend had room, got %d", got)
+			}
+
+			// Every backend saturated
+			if err := free.BeginConnect(); err != nil {
+				t.Fatalf("Failed to begin connect: %v", err)
+			}
+			_, err := lb.Pick("192.168.1.1")
+			if !errors.Is(err, ErrSaturated) {
+				t.Fatalf("Expected ErrSaturated, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "max_connections: 1, max_pending: 1") {
+				t.Errorf("Expected the limits hit in the error, got %q", err)
+			}
+			if full.Overflows().Connections != 1 || free.Overflows().Pending != 1 {
+				t.Errorf("Expected the refused pick counted once on each backend, got %+v and %+v", full.Overflows(), free.Overflows())
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerConcurrentPicks(t *testing.T) {
+	for name, newBalancer := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			pool := backend.NewPool()
+			b, _ := pool.AddBackend("10.0.0.1:8080", 1, backend.WithLimits(backend.Limits{MaxConnections: 5}))
+			lb := newBalancer(pool)
+
+			var picked atomic.Int64
+			var wg sync.WaitGroup
+			for i := range 50 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := lb.Pick(fmt.Sprintf("192.168.1.%d", i)); err == nil {
+						picked.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if picked.Load() != 5 || b.ConnCount() != 5 {
+				t.Errorf("Expected 5 picks, got %d picked and %d counted", picked.Load(), b.ConnCount())
+			}
+			if got := b.Overflows().Connections; got != 45 {
+				t.Errorf("Expected 45 overflows, got %d", got)
+			}
+		})
+	}
+}
+
+func TestPriorityFailover(t *testing.T) {
+	for name, newBalancer := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			pool := backend.NewPool()
+			a, _ := pool.AddBackend("10.0.0.1:8080", 1)
+			b, _ := pool.AddBackend("10.0.0.2:8080", 1)
+			_, _ = pool.AddBackend("10.0.1.1:8080", 1, backend.WithPriority(1))
+
+			lb := newBalancer(pool)
+			pickTier := func(want int, exclude ...string) {
+				t.Helper()
+				for i := range 20 {
+					picked, err := lb.Pick(fmt.Sprintf("192.168.1.%d", i), exclude...)
+					if err != nil {
+						t.Fatalf("Failed to pick: %v", err)
+					}
+					picked.DecConn()
+					if picked.Priority() != want {
+						t.Fatalf("Expected a backend of tier %d, got %s of tier %d", want, picked.Address, picked.Priority())
+					}
+				}
+			}
+
+			pickTier(0)
+
+			// Backups take over when the primaries are gone or ruled out
+			pickTier(1, a.Address, b.Address)
+			a.MarkDead()
+			b.MarkDead()
+			pickTier(1)
+
+			// and hand back once one recovers, sticky pins included
+			b.MarkAlive()
+			pickTier(0)
+		})
+	}
+}
+
+func TestPriorityOverprovisioning(t *testing.T) {
+	for name, newBalancer := range algorithms {
+		t.Run(name, func(t *testing.T) {
+			pool := backend.NewPool()
+			pool.SetOverprovisioning(1.4)
+			for i := range 10 {
+				b, _ := pool.AddBackend(fmt.Sprintf("10.0.0.%d:8080", i+1), 1)
+				if i < 5 {
+					b.MarkDead()
+				}
+			}
+			for i := range 5 {
+				_, _ = pool.AddBackend(fmt.Sprintf("10.0.1.%d:8080", i+1), 1, backend.WithPriority(1))
+			}
+
+			// Half the primaries healthy: 70% stays on them, 30% spills over
+			lb := newBalancer(pool)
+			backups := 0
+			for i := range 1000 {
+				picked, err := lb.Pick(fmt.Sprintf("192.168.%d.%d", i/256, i%256))
+				if err != nil {
+					t.Fatalf("Failed to pick: %v", err)
+				}
+				picked.DecConn()
+				if picked.Priority() == 1 {
+					backups++
+				}
+			}
+			if backups < 200 || backups > 400 {
+				t.Errorf("Expected about 300 of 1000 picks on the backup tier, got %d", backups)
+			}
+		})
+	}
+}
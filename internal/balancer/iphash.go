@@ -2,7 +2,6 @@ package balancer
 
 import (
 	"LoadBalancer/internal/backend"
-	"errors"
 	"hash/fnv"
 )
 
@@ -26,11 +25,14 @@ func hrwHash(key, backend string) uint64 {
 	return h.Sum64()
 }
 
-func (ip *IPHash) Pick(clientIP string) (*backend.Backend, error) {
-	backends := ip.pool.AliveSnapshot()
-	n := len(backends)
-	if n == 0 {
-		return nil, errors.New("no alive backends")
+func (ip *IPHash) Pick(clientIP string, exclude ...string) (*backend.Backend, error) {
+	return acquire(clientIP, exclude, ip.pick)
+}
+
+func (ip *IPHash) pick(clientIP string, exclude []string) (*backend.Backend, error) {
+	backends, err := keyedCandidates(ip.pool, clientIP, exclude)
+	if err != nil {
+		return nil, err
 	}
 
 	var selected *backend.Backend
@@ -44,6 +46,5 @@ func (ip *IPHash) Pick(clientIP string) (*backend.Backend, error) {
 		}
 	}
 
-	selected.IncConn()
 	return selected, nil
 }
@@ -2,7 +2,6 @@ package balancer
 
 import (
 	"LoadBalancer/internal/backend"
-	"errors"
 )
 
 type LeastConnections struct {
@@ -15,22 +14,30 @@ func NewLeastConnectionsBalancer(pool *backend.Pool) *LeastConnections {
 	}
 }
 
-func (lc *LeastConnections) Pick(_ string) (*backend.Backend, error) {
-	backends := lc.pool.AliveSnapshot()
-	n := len(backends)
-	if n == 0 {
-		return nil, errors.New("no alive backends")
+func (lc *LeastConnections) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	return acquire(key, exclude, lc.pick)
+}
+
+func (lc *LeastConnections) pick(_ string, exclude []string) (*backend.Backend, error) {
+	backends, err := candidates(lc.pool, exclude)
+	if err != nil {
+		return nil, err
 	}
 
+	// Backends in slow start count as busier than they are:
+	// score = (connections + 1) / slow-start factor
 	selected := backends[0]
-	minCount := selected.ConnCount()
+	minScore := leastConnScore(selected)
 	for _, b := range backends {
-		currCount := b.ConnCount()
-		if currCount < minCount {
+		score := leastConnScore(b)
+		if score < minScore {
 			selected = b
-			minCount = currCount
+			minScore = score
 		}
 	}
-	selected.IncConn()
 	return selected, nil
 }
+
+func leastConnScore(b *backend.Backend) float64 {
+	return float64(b.ConnCount()+1) / b.SlowStartFactor()
+}
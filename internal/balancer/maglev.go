@@ -0,0 +1,204 @@
+package balancer
+
+import (
+	"LoadBalancer/internal/backend"
+	"cmp"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Smallest lookup table size. The table is kept well above the number of
+// backends so each gets close to an equal share of the slots.
+const (
+	maglevMinSize      = 65537
+	maglevSlotsPerNode = 100
+)
+
+// Maglev consistent hashing: every alive backend fills slots of a lookup
+// table in its own pseudo random order, so a client IP maps to a backend
+// with one hash and one index. The table is rebuilt when the pool's alive
+// set changes, which moves only about 1/N of the keys. Every priority tier
+// gets a table of its own.
+
+type Maglev struct {
+	pool  *backend.Pool
+	mu    sync.Mutex // serialises rebuilds
+	table atomic.Pointer[maglevTable]
+}
+
+type maglevTable struct {
+	generation uint64
+	tiers      []*maglevTier // sorted by priority
+}
+
+type maglevTier struct {
+	priority int
+	backends []*backend.Backend
+	lookup   []int32 // slot -> index into backends
+}
+
+func NewMaglevBalancer(pool *backend.Pool) *Maglev {
+	return &Maglev{
+		pool: pool,
+	}
+}
+
+func (m *Maglev) Pick(clientIP string, exclude ...string) (*backend.Backend, error) {
+	return acquire(clientIP, exclude, m.pick)
+}
+
+func (m *Maglev) pick(clientIP string, exclude []string) (*backend.Backend, error) {
+	t := m.current()
+	if len(t.tiers) == 0 {
+		return nil, errNoBackends
+	}
+
+	tiers := t.tiers
+	if len(tiers) > 1 {
+		order := m.pool.Failover(keyDraw(clientIP))
+		tiers = byFailover(tiers, func(t *maglevTier) int { return t.priority }, order)
+	}
+
+	h := maglevHash(clientIP)
+	var saturated saturation
+	for _, tier := range tiers {
+		if b := tier.pick(h, exclude, &saturated); b != nil {
+			return b, nil
+		}
+	}
+	return nil, saturated.refuse()
+}
+
+// pick returns the backend for hash h, or nil if every backend of the tier
+// is excluded or saturated.
+func (t *maglevTier) pick(h uint64, exclude []string, saturated *saturation) *backend.Backend {
+	// Excluded and saturated backends are skipped by walking on to the
+	// next slots
+	out := newRuledOut(len(t.backends))
+	size := uint64(len(t.lookup))
+	slot := h % size
+	for i := range size {
+		idx := t.lookup[(slot+i)%size]
+		b := t.backends[idx]
+		if !out.skip(idx, b, exclude) {
+			return b
+		}
+		if out.all() {
+			break
+		}
+	}
+	*saturated = append(*saturated, out.saturated...)
+	return nil
+}
+
+// current returns the table for the pool's current generation, building it
+// if the pool has changed since the last pick.
+func (m *Maglev) current() *maglevTable {
+	gen := m.pool.Generation()
+	if t := m.table.Load(); t != nil && t.generation == gen {
+		return t
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t := m.table.Load(); t != nil && t.generation == gen {
+		return t
+	}
+
+	// Sorted so the table does not depend on the order backends were added
+	backends := m.pool.AliveSnapshot()
+	slices.SortFunc(backends, func(a, b *backend.Backend) int {
+		return cmp.Or(cmp.Compare(a.Priority(), b.Priority()), strings.Compare(a.Address, b.Address))
+	})
+
+	t := &maglevTable{generation: gen}
+	for len(backends) > 0 {
+		n := 1
+		for n < len(backends) && backends[n].Priority() == backends[0].Priority() {
+			n++
+		}
+		t.tiers = append(t.tiers, &maglevTier{
+			priority: backends[0].Priority(),
+			backends: backends[:n:n],
+			lookup:   maglevPopulate(backends[:n]),
+		})
+		backends = backends[n:]
+	}
+	m.table.Store(t)
+	return t
+}
+
+// maglevPopulate fills the lookup table as in the Maglev paper: backends
+// take turns claiming the next free slot of their permutation.
+func maglevPopulate(backends []*backend.Backend) []int32 {
+	n := len(backends)
+	if n == 0 {
+		return nil
+	}
+	size := uint64(nextPrime(max(maglevMinSize, n*maglevSlotsPerNode)))
+
+	offsets := make([]uint64, n)
+	skips := make([]uint64, n)
+	next := make([]uint64, n)
+	for i, b := range backends {
+		offsets[i] = maglevHash(b.Address) % size
+		skips[i] = maglevSkipHash(b.Address)%(size-1) + 1
+	}
+
+	lookup := make([]int32, size)
+	for i := range lookup {
+		lookup[i] = -1
+	}
+
+	filled := uint64(0)
+	for {
+		for i := range n {
+			slot := (offsets[i] + next[i]*skips[i]) % size
+			for lookup[slot] >= 0 {
+				next[i]++
+				slot = (offsets[i] + next[i]*skips[i]) % size
+			}
+			lookup[slot] = int32(i)
+			next[i]++
+			filled++
+			if filled == size {
+				return lookup
+			}
+		}
+	}
+}
+
+func maglevHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func maglevSkipHash(key string) uint64 {
+	h := fnv.New64()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func nextPrime(n int) int {
+	for ; ; n++ {
+		if isPrime(n) {
+			return n
+		}
+	}
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
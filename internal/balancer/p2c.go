@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"LoadBalancer/internal/backend"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Random probes before falling back to a scan of the alive backends, which
+// only happens when most of the pool is down or excluded
+const p2cProbes = 8
+
+// Power of two choices: sample two backends at random and keep the one with
+// the lower score = (connections + 1) / weight, or just connections + 1
+// when not weighted. With equal weights both are simply the one with fewer
+// connections. Picks do not scan the pool. Samples outside the priority
+// tier drawn for the pick are thrown back, and so are backends of weight 0.
+
+type P2C struct {
+	pool     *backend.Pool
+	weighted bool
+}
+
+func NewP2CBalancer(pool *backend.Pool, weighted bool) *P2C {
+	return &P2C{
+		pool:     pool,
+		weighted: weighted,
+	}
+}
+
+func (p *P2C) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	return acquire(key, exclude, p.pick)
+}
+
+func (p *P2C) pick(_ string, exclude []string) (*backend.Backend, error) {
+	a, b, err := p.sample(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := a
+	if b != nil && p.score(b) < p.score(a) {
+		selected = b
+	}
+	return selected, nil
+}
+
+// sample returns two distinct eligible backends, or one if that is all
+// there is.
+func (p *P2C) sample(exclude []string) (*backend.Backend, *backend.Backend, error) {
+	order := p.pool.Failover(rand.Float64())
+	var a *backend.Backend
+	for range p2cProbes {
+		c := p.pool.Random()
+		if c == nil {
+			return nil, nil, errNoBackends
+		}
+		if c == a || len(order) > 1 && c.Priority() != order[0] || !p2cEligible(c, exclude) {
+			continue
+		}
+		if a == nil {
+			a = c
+			continue
+		}
+		return a, c, nil
+	}
+
+	backends, err := candidatesIn(p.pool, order, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	backends = slices.DeleteFunc(backends, func(b *backend.Backend) bool { return b.GetWeight() <= 0 })
+	switch len(backends) {
+	case 0:
+		return nil, nil, errNoBackends
+	case 1:
+		return backends[0], nil, nil
+	}
+	i := rand.IntN(len(backends))
+	j := rand.IntN(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+	return backends[i], backends[j], nil
+}
+
+func p2cEligible(b *backend.Backend, exclude []string) bool {
+	return b.Available() && b.GetWeight() > 0 && !slices.Contains(exclude, b.Address) && b.Saturated() == ""
+}
+
+func (p *P2C) score(b *backend.Backend) float64 {
+	load := float64(b.ConnCount() + 1)
+	if !p.weighted {
+		return load
+	}
+	weight := b.GetWeight()
+	if weight <= 0 {
+		// Sampled before its weight was set to 0, never preferred
+		return math.MaxFloat64
+	}
+	return load / float64(weight)
+}
@@ -0,0 +1,59 @@
+package balancer
+
+import (
+	"LoadBalancer/internal/backend"
+	"math"
+)
+
+// Cost of a backend that has requests in flight but has not reported a
+// latency yet, so it is probed with one request at a time
+const peakEWMAPenalty = math.MaxFloat64 / 2
+
+// Picking the backend with the minimum cost achieved using the formula:
+// cost = peak-EWMA latency * (connections + 1)
+// The latency decays toward zero while a backend reports nothing, so one
+// that spiked gets picked again once the others' cost exceeds its own.
+// Backends with no latency observed yet cost nothing while idle.
+
+type PeakEWMA struct {
+	pool *backend.Pool
+}
+
+func NewPeakEWMABalancer(pool *backend.Pool) *PeakEWMA {
+	return &PeakEWMA{
+		pool: pool,
+	}
+}
+
+func (p *PeakEWMA) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	return acquire(key, exclude, p.pick)
+}
+
+func (p *PeakEWMA) pick(_ string, exclude []string) (*backend.Backend, error) {
+	backends, err := candidates(p.pool, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := backends[0]
+	minCost := peakEWMACost(selected)
+	for _, b := range backends[1:] {
+		if cost := peakEWMACost(b); cost < minCost {
+			selected = b
+			minCost = cost
+		}
+	}
+	return selected, nil
+}
+
+func peakEWMACost(b *backend.Backend) float64 {
+	latency := float64(b.DecayedLatency())
+	inflight := float64(b.ConnCount())
+	if b.Latency() == 0 {
+		if inflight == 0 {
+			return 0
+		}
+		return peakEWMAPenalty
+	}
+	return latency * (inflight + 1)
+}
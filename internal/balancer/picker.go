@@ -1,7 +1,201 @@
 package balancer
 
-import "LoadBalancer/internal/backend"
+import (
+	"LoadBalancer/internal/backend"
+	"cmp"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
 
+// ErrSaturated is returned when every backend that could be picked is at one
+// of its circuit breaker limits.
+var ErrSaturated = errors.New("all backends are at their circuit breaker limits")
+
+var errNoBackends = errors.New("no alive backends")
+
+// Balancer picks a backend for a connection keyed by key, skipping any
+// backend whose address is listed in exclude. The picked backend's
+// connection count is already incremented.
 type Balancer interface {
-	Pick(key string) (*backend.Backend, error)
+	Pick(key string, exclude ...string) (*backend.Backend, error)
+}
+
+// acquire returns the backend pick chooses with a connection taken on it.
+// Another pick can take a backend's last slot between the check and the
+// taking, and then pick chooses again, now seeing that backend saturated.
+func acquire(key string, exclude []string, pick func(string, []string) (*backend.Backend, error)) (*backend.Backend, error) {
+	for {
+		b, err := pick(key, exclude)
+		if err != nil || b.AcquireConn() {
+			return b, err
+		}
+	}
+}
+
+// candidates returns the alive backends of pool that are not excluded and
+// not at a circuit breaker limit, all of one priority tier, or an error
+// saying why there are none. The tier is drawn at random by the tiers'
+// shares of traffic, failing over to the others if it has no candidates.
+func candidates(pool *backend.Pool, exclude []string) ([]*backend.Backend, error) {
+	return candidatesIn(pool, pool.Failover(rand.Float64()), exclude)
+}
+
+// keyedCandidates is candidates with the tier drawn from key, so hash
+// based balancers keep a key in one tier while the shares stay the same.
+func keyedCandidates(pool *backend.Pool, key string, exclude []string) ([]*backend.Backend, error) {
+	return candidatesIn(pool, pool.Failover(keyDraw(key)), exclude)
+}
+
+// anyTier makes usable keep backends of every priority.
+const anyTier = -1
+
+func candidatesIn(pool *backend.Pool, order []int, exclude []string) ([]*backend.Backend, error) {
+	// AliveSnapshot hands out a fresh slice, so it can be filtered in place
+	backends := pool.AliveSnapshot()
+
+	var saturated saturation
+	if len(order) <= 1 {
+		if out := usable(backends, anyTier, exclude, &saturated); len(out) > 0 {
+			return out, nil
+		}
+		return nil, saturated.refuse()
+	}
+	for _, priority := range order {
+		if out := usable(backends, priority, exclude, &saturated); len(out) > 0 {
+			return out, nil
+		}
+	}
+	return nil, saturated.refuse()
+}
+
+// usable filters backends in place down to those of tier priority that are
+// neither excluded nor saturated. backends is left as it was if there are
+// none, so it can be filtered again for the next tier.
+func usable(backends []*backend.Backend, priority int, exclude []string, saturated *saturation) []*backend.Backend {
+	out := backends[:0]
+	for _, b := range backends {
+		if priority != anyTier && b.Priority() != priority {
+			continue
+		}
+		if len(exclude) > 0 && slices.Contains(exclude, b.Address) {
+			continue
+		}
+		if reason := b.Saturated(); reason != "" {
+			saturated.add(b, reason)
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// byFailover returns tiers, sorted by priority, in the order given by
+// Pool.Failover, leaving out the ones it does not name.
+func byFailover[T any](tiers []T, priority func(T) int, order []int) []T {
+	if len(order) <= 1 {
+		return tiers
+	}
+	out := make([]T, 0, len(order))
+	for _, p := range order {
+		i, ok := slices.BinarySearchFunc(tiers, p, func(t T, p int) int { return cmp.Compare(priority(t), p) })
+		if ok {
+			out = append(out, tiers[i])
+		}
+	}
+	return out
+}
+
+// keyDraw maps key onto [0, 1) for Pool.Failover, independently of the
+// hashes balancers place keys with.
+func keyDraw(key string) float64 {
+	h := fnv.New64()
+	h.Write([]byte(key))
+	return float64(mix64(h.Sum64())>>11) / (1 << 53)
+}
+
+// mix64 is the murmur3 finalizer, spreading every input bit over the
+// whole hash.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// saturation lists the backends ruled out by a circuit breaker limit, with
+// the limit each one hit.
+type saturation []saturated
+
+type saturated struct {
+	backend *backend.Backend
+	limit   string
+}
+
+func (s *saturation) add(b *backend.Backend, limit string) {
+	*s = append(*s, saturated{b, limit})
+}
+
+// refuse counts the connection no backend was left for as an overflow of
+// each saturated backend, and explains why, naming how many backends hit
+// each limit.
+func (s saturation) refuse() error {
+	if len(s) == 0 {
+		return errNoBackends
+	}
+	hits := make(map[string]int)
+	for _, sat := range s {
+		sat.backend.AddOverflow(sat.limit)
+		hits[sat.limit]++
+	}
+	reasons := make([]string, 0, len(hits))
+	for _, limit := range []string{backend.LimitConnections, backend.LimitPending, backend.LimitConnectRate} {
+		if n := hits[limit]; n > 0 {
+			reasons = append(reasons, fmt.Sprintf("%s: %d", limit, n))
+		}
+	}
+	return fmt.Errorf("%w (%s)", ErrSaturated, strings.Join(reasons, ", "))
+}
+
+// ruledOut tracks the backends a hash table walk has passed over, so each
+// is checked, and listed as saturated, once however many slots it holds.
+type ruledOut struct {
+	n         int
+	left      int
+	skipped   []bool // by backend index, allocated on the first skip
+	saturated saturation
+}
+
+func newRuledOut(n int) *ruledOut {
+	return &ruledOut{n: n, left: n}
+}
+
+// skip reports whether backend i, b, is excluded or saturated.
+func (r *ruledOut) skip(i int32, b *backend.Backend, exclude []string) bool {
+	if r.skipped != nil && r.skipped[i] {
+		return true
+	}
+	if len(exclude) == 0 || !slices.Contains(exclude, b.Address) {
+		reason := b.Saturated()
+		if reason == "" {
+			return false
+		}
+		r.saturated.add(b, reason)
+	}
+	if r.skipped == nil {
+		r.skipped = make([]bool, r.n)
+	}
+	r.skipped[i] = true
+	r.left--
+	return true
+}
+
+// all reports whether every backend has been ruled out.
+func (r *ruledOut) all() bool {
+	return r.left == 0
 }
@@ -0,0 +1,174 @@
+package balancer
+
+import (
+	"LoadBalancer/internal/backend"
+	"cmp"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Consistent hashing with bounded loads: client IPs hash onto a ring of
+// virtual nodes, VirtualNodes per unit of weight, and are served by the
+// first backend clockwise that is not over its capacity:
+// capacity = ceil((1 + epsilon) * (connections + 1) * weight / totalWeight)
+// A hot key spills over to the next backends on the ring instead of
+// overloading its own. Every priority tier gets a ring of its own.
+
+type RingHash struct {
+	pool         *backend.Pool
+	virtualNodes int
+	epsilon      float64
+
+	mu   sync.Mutex // serialises rebuilds
+	ring atomic.Pointer[hashRing]
+}
+
+type hashRing struct {
+	generation uint64
+	tiers      []*ringTier // sorted by priority
+}
+
+type ringTier struct {
+	priority    int
+	backends    []*backend.Backend
+	totalWeight int64
+	points      []ringPoint // sorted by hash
+}
+
+type ringPoint struct {
+	hash    uint64
+	backend int32 // index into backends
+}
+
+func NewRingHashBalancer(pool *backend.Pool, virtualNodes int, epsilon float64) *RingHash {
+	return &RingHash{
+		pool:         pool,
+		virtualNodes: virtualNodes,
+		epsilon:      epsilon,
+	}
+}
+
+func (r *RingHash) Pick(clientIP string, exclude ...string) (*backend.Backend, error) {
+	return acquire(clientIP, exclude, r.pick)
+}
+
+func (r *RingHash) pick(clientIP string, exclude []string) (*backend.Backend, error) {
+	ring := r.current()
+	if len(ring.tiers) == 0 {
+		return nil, errNoBackends
+	}
+
+	tiers := ring.tiers
+	if len(tiers) > 1 {
+		order := r.pool.Failover(keyDraw(clientIP))
+		tiers = byFailover(tiers, func(t *ringTier) int { return t.priority }, order)
+	}
+
+	h := ringHash(clientIP)
+	var saturated saturation
+	for _, tier := range tiers {
+		inflight := r.pool.TierConnCount(tier.priority)
+		if b := tier.pick(h, r.epsilon, inflight, exclude, &saturated); b != nil {
+			return b, nil
+		}
+	}
+	return nil, saturated.refuse()
+}
+
+// pick returns the backend for hash h, or nil if every backend of the tier
+// is excluded or saturated. inflight is the tier's open connection count.
+func (t *ringTier) pick(h uint64, epsilon float64, inflight int64, exclude []string, saturated *saturation) *backend.Backend {
+	share := (1 + epsilon) * float64(inflight+1) / float64(t.totalWeight)
+
+	start, _ := slices.BinarySearchFunc(t.points, h, func(p ringPoint, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+
+	// The first eligible backend is kept in case every one is over capacity,
+	// which only happens while connections close between the count and here
+	var fallback *backend.Backend
+	out := newRuledOut(len(t.backends))
+	for i := range t.points {
+		idx := t.points[(start+i)%len(t.points)].backend
+		b := t.backends[idx]
+		if out.skip(idx, b, exclude) {
+			if out.all() {
+				break
+			}
+			continue
+		}
+		if fallback == nil {
+			fallback = b
+		}
+		capacity := math.Ceil(share * float64(b.GetWeight()))
+		if float64(b.ConnCount()) < capacity {
+			return b
+		}
+	}
+	*saturated = append(*saturated, out.saturated...)
+	return fallback
+}
+
+// current returns the ring for the pool's current generation, building it
+// if the pool has changed since the last pick.
+func (r *RingHash) current() *hashRing {
+	gen := r.pool.Generation()
+	if ring := r.ring.Load(); ring != nil && ring.generation == gen {
+		return ring
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ring := r.ring.Load(); ring != nil && ring.generation == gen {
+		return ring
+	}
+
+	ring := &hashRing{generation: gen}
+	tiers := make(map[int]*ringTier)
+	for _, b := range r.pool.AliveSnapshot() {
+		weight := b.GetWeight()
+		if weight <= 0 {
+			continue
+		}
+		tier, ok := tiers[b.Priority()]
+		if !ok {
+			tier = &ringTier{priority: b.Priority()}
+			tiers[tier.priority] = tier
+			ring.tiers = append(ring.tiers, tier)
+		}
+		idx := int32(len(tier.backends))
+		tier.backends = append(tier.backends, b)
+		tier.totalWeight += weight
+
+		for v := range int64(r.virtualNodes) * weight {
+			tier.points = append(tier.points, ringPoint{
+				hash:    ringHash(b.Address + "#" + strconv.FormatInt(v, 10)),
+				backend: idx,
+			})
+		}
+	}
+	slices.SortFunc(ring.tiers, func(a, b *ringTier) int {
+		return cmp.Compare(a.priority, b.priority)
+	})
+	for _, tier := range ring.tiers {
+		slices.SortFunc(tier.points, func(a, b ringPoint) int {
+			return cmp.Compare(a.hash, b.hash)
+		})
+	}
+
+	r.ring.Store(ring)
+	return ring
+}
+
+// ringHash is FNV-1a followed by the murmur3 finalizer; FNV alone leaves
+// keys that differ in their last characters, like vnode labels and
+// neighbouring IPs, bunched together on the ring.
+func ringHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return mix64(h.Sum64())
+}
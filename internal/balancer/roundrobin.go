@@ -2,33 +2,47 @@ package balancer
 
 import (
 	"LoadBalancer/internal/backend"
-	"errors"
+	"math/rand/v2"
 	"sync/atomic"
 )
 
 type RoundRobin struct {
-	pool *backend.Pool
-	next uint64
+	pool   *backend.Pool
+	next   uint64
+	random func() float64 // draws for slow start, seeded in tests
 }
 
 func NewRoundRobinBalancer(pool *backend.Pool) *RoundRobin {
 	return &RoundRobin{
-		pool: pool,
+		pool:   pool,
+		random: rand.Float64,
 	}
 }
 
-func (rr *RoundRobin) Pick(_ string) (*backend.Backend, error) {
-	backends := rr.pool.AliveSnapshot()
-	n := len(backends)
-	if n == 0 {
-		return nil, errors.New("no alive backends")
+func (rr *RoundRobin) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	return acquire(key, exclude, rr.pick)
+}
+
+func (rr *RoundRobin) pick(_ string, exclude []string) (*backend.Backend, error) {
+	backends, err := candidates(rr.pool, exclude)
+	if err != nil {
+		return nil, err
 	}
+	n := len(backends)
 
 	// Simple atomic increment and modulo
 	next := atomic.AddUint64(&rr.next, 1)
 	idx := (next - 1) % uint64(n)
 
+	// A backend in slow start only takes its turn with a probability of
+	// its slow-start factor, otherwise the turn passes to the next one
 	b := backends[idx]
-	b.IncConn()
+	for i := range uint64(n) {
+		candidate := backends[(idx+i)%uint64(n)]
+		if f := candidate.SlowStartFactor(); f >= 1 || rr.random() < f {
+			b = candidate
+			break
+		}
+	}
 	return b, nil
 }
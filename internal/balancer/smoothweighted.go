@@ -0,0 +1,72 @@
+package balancer
+
+import (
+	"LoadBalancer/internal/backend"
+	"errors"
+	"sync"
+)
+
+// Smooth weighted round robin as in nginx: on every pick each backend's
+// current weight grows by its weight, the highest one is picked and set
+// back by the total. Weights 5, 1, 1 give a a b a c a a rather than
+// a a a a a b c. Weights are read on every pick, so Pool.UpdateWeight
+// takes effect immediately.
+
+type SmoothWeighted struct {
+	pool *backend.Pool
+
+	mu         sync.Mutex
+	current    map[string]int64 // current weight by backend address
+	generation uint64
+}
+
+func NewSmoothWeightedBalancer(pool *backend.Pool) *SmoothWeighted {
+	return &SmoothWeighted{
+		pool:    pool,
+		current: make(map[string]int64),
+	}
+}
+
+func (sw *SmoothWeighted) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	return acquire(key, exclude, sw.pick)
+}
+
+func (sw *SmoothWeighted) pick(_ string, exclude []string) (*backend.Backend, error) {
+	backends, err := candidates(sw.pool, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	// Start over when the pool changes so removed backends do not linger
+	if gen := sw.pool.Generation(); gen != sw.generation {
+		sw.generation = gen
+		clear(sw.current)
+	}
+
+	var selected *backend.Backend
+	var total, best int64
+	for _, b := range backends {
+		weight := b.GetWeight()
+		if weight <= 0 {
+			continue
+		}
+		cw := sw.current[b.Address] + weight
+		sw.current[b.Address] = cw
+		total += weight
+
+		if selected == nil || cw > best {
+			selected = b
+			best = cw
+		}
+	}
+
+	if selected == nil {
+		return nil, errors.New("no alive backends")
+	}
+	sw.current[selected.Address] -= total
+
+	return selected, nil
+}
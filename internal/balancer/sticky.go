@@ -0,0 +1,162 @@
+package balancer
+
+import (
+	"LoadBalancer/internal/backend"
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Sticky sessions: the backend picked for a key is remembered for TTL after
+// its last use and picked again for that key while it is available, not
+// saturated, still in the pool and in a priority tier that gets traffic.
+// Otherwise the wrapped balancer picks and the key is pinned to its choice.
+// The table holds at most MaxEntries keys, dropping the least recently used
+// one when full.
+
+type Sticky struct {
+	next       Balancer
+	pool       *backend.Pool
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *stickyEntry, most recently used first
+}
+
+type stickyEntry struct {
+	key     string
+	address string
+	expires time.Time
+}
+
+// StickyEntry is a snapshot of one pinned key.
+type StickyEntry struct {
+	Key       string
+	Backend   string
+	ExpiresAt time.Time
+}
+
+func NewStickyBalancer(next Balancer, pool *backend.Pool, ttl time.Duration, maxEntries int) *Sticky {
+	return &Sticky{
+		next:       next,
+		pool:       pool,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (s *Sticky) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	if key == "" {
+		return s.next.Pick(key, exclude...)
+	}
+
+	now := time.Now()
+	if b := s.lookup(key, now, exclude); b != nil && b.AcquireConn() {
+		return b, nil
+	}
+
+	b, err := s.next.Pick(key, exclude...)
+	if err != nil {
+		return nil, err
+	}
+	s.store(key, b.Address, now)
+	return b, nil
+}
+
+// lookup returns the backend key is pinned to if it can still serve it,
+// extending the entry's TTL.
+func (s *Sticky) lookup(key string, now time.Time, exclude []string) *backend.Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := e.Value.(*stickyEntry)
+	if !now.Before(entry.expires) || slices.Contains(exclude, entry.address) {
+		return nil
+	}
+	b, err := s.pool.GetBackend(entry.address)
+	if err != nil || !b.Available() || !s.pool.TierActive(b.Priority()) || b.Saturated() != "" {
+		return nil
+	}
+	entry.expires = now.Add(s.ttl)
+	s.lru.MoveToFront(e)
+	return b
+}
+
+func (s *Sticky) store(key, address string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		entry := e.Value.(*stickyEntry)
+		entry.address = address
+		entry.expires = now.Add(s.ttl)
+		s.lru.MoveToFront(e)
+		return
+	}
+
+	// Every entry gets the same TTL on use, so the least recently used
+	// ones are also the first to expire
+	for back := s.lru.Back(); back != nil; back = s.lru.Back() {
+		if s.lru.Len() < s.maxEntries && now.Before(back.Value.(*stickyEntry).expires) {
+			break
+		}
+		s.drop(back)
+	}
+
+	s.entries[key] = s.lru.PushFront(&stickyEntry{key: key, address: address, expires: now.Add(s.ttl)})
+}
+
+func (s *Sticky) drop(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.entries, e.Value.(*stickyEntry).key)
+}
+
+// Entries returns the unexpired entries, most recently used first.
+func (s *Sticky) Entries() []StickyEntry {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]StickyEntry, 0, s.lru.Len())
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*stickyEntry)
+		if !now.Before(entry.expires) {
+			break
+		}
+		out = append(out, StickyEntry{Key: entry.key, Backend: entry.address, ExpiresAt: entry.expires})
+	}
+	return out
+}
+
+// Remove forgets key and reports whether it was pinned.
+func (s *Sticky) Remove(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if ok {
+		s.drop(e)
+	}
+	return ok
+}
+
+// Flush forgets every key and returns how many there were.
+func (s *Sticky) Flush() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.lru.Len()
+	clear(s.entries)
+	s.lru.Init()
+	return n
+}
@@ -18,23 +18,27 @@ func NewWeightedBalancer(pool *backend.Pool) *Weighted {
 
 // Picking a backend based on the minimum score for the backend achieved using the formula:
 // score = (connections + 1) / weight
-func (w *Weighted) Pick(_ string) (*backend.Backend, error) {
-	backends := w.pool.AliveSnapshot()
-	n := len(backends)
-	if n == 0 {
-		return nil, errors.New("no alive backends")
+// with the weight scaled down while a backend is in slow start.
+func (w *Weighted) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	return acquire(key, exclude, w.pick)
+}
+
+func (w *Weighted) pick(_ string, exclude []string) (*backend.Backend, error) {
+	backends, err := candidates(w.pool, exclude)
+	if err != nil {
+		return nil, err
 	}
 
 	var selected *backend.Backend
 	minScore := math.MaxFloat64
 
 	for _, b := range backends {
-		weight := b.GetWeight()
+		weight := b.EffectiveWeight()
 		if weight <= 0 {
 			continue
 		}
 
-		score := float64(b.ConnCount()+1) / float64(weight)
+		score := float64(b.ConnCount()+1) / weight
 
 		if score < minScore {
 			minScore = score
@@ -46,6 +50,5 @@ func (w *Weighted) Pick(_ string) (*backend.Backend, error) {
 		return nil, errors.New("no backend selected")
 	}
 
-	selected.IncConn()
 	return selected, nil
 }
@@ -1,11 +1,16 @@
 package config
 
 import (
+	"LoadBalancer/internal/proxyproto"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 
 	"strings"
 
@@ -13,14 +18,58 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Protocols spoken to backends in http mode
+const (
+	BackendHTTP1 = "http1"
+	BackendH2C   = "h2c"
+)
+
+// DefaultPool names the pool built from the top-level backends.
+const DefaultPool = "default"
+
+// DefaultFrontend names the frontend built from the top-level settings.
+const DefaultFrontend = "default"
+
+// RetryConnectFailure in retry_on retries requests whose backend could not
+// be reached.
+const RetryConnectFailure = "connect-failure"
+
+// StickyClientIP keys sticky sessions by client IP.
+const StickyClientIP = "client_ip"
+
 type Config struct {
-	ListenAddress string       `yaml:"listen_address" json:"listen_address" toml:"listen_address"`
-	UseIOUring    bool         `yaml:"use_iouring" json:"use_iouring" toml:"use_iouring"`
-	Algorithm     string       `yaml:"algorithm" json:"algorithm" toml:"algorithm"`
-	Backends      []BackendCfg `yaml:"backends" json:"backends" toml:"backends"`
-	HealthCheck   HealthCfg    `yaml:"health_check" json:"health_check" toml:"health_check"`
-	Timeout       TimeoutCfg   `yaml:"timeout" json:"timeout" toml:"timeout"`
-	Discovery     DiscoveryCfg `yaml:"discovery" json:"discovery" toml:"discovery"`
+	// A single frontend configured at the top level. It is used when
+	// Frontends is empty so single-listener configs keep working.
+	FrontendCfg `yaml:",inline"`
+	Frontends   []FrontendCfg `yaml:"frontends" json:"frontends" toml:"frontends"`
+}
+
+// FrontendCfg is one listener with its own backends, algorithm, health
+// checks and discovery.
+type FrontendCfg struct {
+	Name           string             `yaml:"name" json:"name" toml:"name"`
+	ListenAddress  string             `yaml:"listen_address" json:"listen_address" toml:"listen_address"`
+	Protocol       string             `yaml:"protocol" json:"protocol" toml:"protocol"`
+	UseIOUring     bool               `yaml:"use_iouring" json:"use_iouring" toml:"use_iouring"`
+	Algorithm      string             `yaml:"algorithm" json:"algorithm" toml:"algorithm"`
+	RingHash       RingHashCfg        `yaml:"ring_hash" json:"ring_hash" toml:"ring_hash"`
+	P2C            P2CCfg             `yaml:"p2c" json:"p2c" toml:"p2c"`
+	Sticky         StickyCfg          `yaml:"sticky" json:"sticky" toml:"sticky"`
+	SlowStart      SlowStartCfg       `yaml:"slow_start" json:"slow_start" toml:"slow_start"`
+	Failover       FailoverCfg        `yaml:"failover" json:"failover" toml:"failover"`
+	ConnectRetries int                `yaml:"connect_retries" json:"connect_retries" toml:"connect_retries"`
+	SendProxy      string             `yaml:"send_proxy" json:"send_proxy" toml:"send_proxy"`
+	AcceptProxy    AcceptProxyCfg     `yaml:"accept_proxy" json:"accept_proxy" toml:"accept_proxy"`
+	TLS            TLSCfg             `yaml:"tls" json:"tls" toml:"tls"`
+	Backends       []BackendCfg       `yaml:"backends" json:"backends" toml:"backends"`
+	Pools          map[string]PoolCfg `yaml:"pools" json:"pools" toml:"pools"`
+	SNIRoutes      []SNIRouteCfg      `yaml:"sni_routes" json:"sni_routes" toml:"sni_routes"`
+	HTTPRoutes     []HTTPRouteCfg     `yaml:"http_routes" json:"http_routes" toml:"http_routes"`
+	HTTP           HTTPCfg            `yaml:"http" json:"http" toml:"http"`
+	HealthCheck    HealthCfg          `yaml:"health_check" json:"health_check" toml:"health_check"`
+	Outlier        OutlierCfg         `yaml:"outlier_detection" json:"outlier_detection" toml:"outlier_detection"`
+	Timeout        TimeoutCfg         `yaml:"timeout" json:"timeout" toml:"timeout"`
+	Discovery      DiscoveryCfg       `yaml:"discovery" json:"discovery" toml:"discovery"`
 }
 
 type DiscoveryCfg struct {
@@ -30,7 +79,9 @@ type DiscoveryCfg struct {
 }
 
 type DockerCfg struct {
-	// Add Docker specific config here if needed
+	// Only containers labelled lb.frontend=<Frontend> are discovered, empty
+	// matches every container with lb.enable=true
+	Frontend string `yaml:"frontend" json:"frontend" toml:"frontend"`
 }
 
 type KubernetesCfg struct {
@@ -38,15 +89,205 @@ type KubernetesCfg struct {
 	Service   string `yaml:"service" json:"service" toml:"service"`
 }
 
+// RingHashCfg tunes the ring_hash algorithm for every pool of a frontend.
+type RingHashCfg struct {
+	// Points on the ring per unit of backend weight
+	VirtualNodes int `yaml:"virtual_nodes" json:"virtual_nodes" toml:"virtual_nodes"`
+	// A backend is skipped once its connections exceed (1+epsilon) times
+	// its weighted share of all connections
+	Epsilon float64 `yaml:"epsilon" json:"epsilon" toml:"epsilon"`
+}
+
+// P2CCfg tunes the p2c algorithm for every pool of a frontend.
+type P2CCfg struct {
+	// Compare connections per unit of weight rather than plain connection
+	// counts. Defaults to true
+	Weighted *bool `yaml:"weighted" json:"weighted" toml:"weighted"`
+}
+
+// StickyCfg pins clients to the backend they were first balanced to, in
+// front of whichever algorithm each pool uses.
+type StickyCfg struct {
+	Enabled bool `yaml:"enabled" json:"enabled" toml:"enabled"`
+	// What identifies a client: "client_ip", or in http and grpc mode
+	// "header:<name>" or "cookie:<name>", falling back to the client IP
+	// when missing. Hash based algorithms balance on it too.
+	Key        string `yaml:"key" json:"key" toml:"key"`
+	TTLSec     int    `yaml:"ttl_sec" json:"ttl_sec" toml:"ttl_sec"`
+	MaxEntries int    `yaml:"max_entries" json:"max_entries" toml:"max_entries"`
+}
+
+// SlowStartCfg ramps up the weight of backends that were just added or
+// came back alive, for the round_robin, weighted and least_connections
+// algorithms.
+type SlowStartCfg struct {
+	// Length of the ramp, 0 disables slow start
+	WindowSec int `yaml:"window_sec" json:"window_sec" toml:"window_sec"`
+	// 1 ramps linearly, higher values ramp faster early on
+	Aggression float64 `yaml:"aggression" json:"aggression" toml:"aggression"`
+	// Share of the weight given at the start of the window
+	MinWeightPercent float64 `yaml:"min_weight_percent" json:"min_weight_percent" toml:"min_weight_percent"`
+}
+
+// FailoverCfg splits traffic between the priority tiers of every pool of a
+// frontend.
+type FailoverCfg struct {
+	// Multiplies the healthy share of a tier before traffic spills over to
+	// the next one, 0 fails over only once a tier has no healthy backend
+	OverprovisioningFactor float64 `yaml:"overprovisioning_factor" json:"overprovisioning_factor" toml:"overprovisioning_factor"`
+}
+
 type BackendCfg struct {
-	Address string `yaml:"address" json:"address" toml:"address"`
-	Weight  int64  `yaml:"weight" json:"weight" toml:"weight"`
+	Address        string            `yaml:"address" json:"address" toml:"address"`
+	Weight         int64             `yaml:"weight" json:"weight" toml:"weight"`
+	SendProxy      string            `yaml:"send_proxy" json:"send_proxy" toml:"send_proxy"`
+	CircuitBreaker CircuitBreakerCfg `yaml:"circuit_breaker" json:"circuit_breaker" toml:"circuit_breaker"`
+	Priority       int               `yaml:"priority" json:"priority" toml:"priority"` // 0 is preferred, higher tiers are backups
+}
+
+func (b BackendCfg) validate() error {
+	if !proxyproto.ValidVersion(b.SendProxy) {
+		return fmt.Errorf("invalid send_proxy for backend %s: %s", b.Address, b.SendProxy)
+	}
+	if err := b.CircuitBreaker.validate(); err != nil {
+		return fmt.Errorf("backend %s: %w", b.Address, err)
+	}
+	if b.Priority < 0 {
+		return fmt.Errorf("backend %s: priority cannot be negative", b.Address)
+	}
+	return nil
+}
+
+// CircuitBreakerCfg limits what a backend is sent; a backend at a limit is
+// skipped. 0 means unlimited.
+type CircuitBreakerCfg struct {
+	// Connections, or requests in http mode, in flight
+	MaxConnections int64 `yaml:"max_connections" json:"max_connections" toml:"max_connections"`
+	// Dials in progress
+	MaxPending int64 `yaml:"max_pending" json:"max_pending" toml:"max_pending"`
+	// Dials started per second
+	MaxConnectsPerSec int64 `yaml:"max_connects_per_sec" json:"max_connects_per_sec" toml:"max_connects_per_sec"`
+}
+
+func (c CircuitBreakerCfg) validate() error {
+	if c.MaxConnections < 0 || c.MaxPending < 0 || c.MaxConnectsPerSec < 0 {
+		return errors.New("circuit_breaker limits must not be negative")
+	}
+	return nil
+}
+
+// PoolCfg is a named set of backends in addition to the default pool built
+// from the top-level backends.
+type PoolCfg struct {
+	Algorithm string       `yaml:"algorithm" json:"algorithm" toml:"algorithm"`
+	Backends  []BackendCfg `yaml:"backends" json:"backends" toml:"backends"`
+	// Discovery feeding this pool; the frontend's only feeds the default pool
+	Discovery DiscoveryCfg `yaml:"discovery" json:"discovery" toml:"discovery"`
+}
+
+type SNIRouteCfg struct {
+	ServerName string `yaml:"server_name" json:"server_name" toml:"server_name"`
+	Pool       string `yaml:"pool" json:"pool" toml:"pool"`
+}
+
+type HTTPCfg struct {
+	H2C             bool         `yaml:"h2c" json:"h2c" toml:"h2c"`
+	BackendProtocol string       `yaml:"backend_protocol" json:"backend_protocol" toml:"backend_protocol"`
+	WebSocket       WebSocketCfg `yaml:"websocket" json:"websocket" toml:"websocket"`
+	Retry           RetryCfg     `yaml:"retry" json:"retry" toml:"retry"`
+}
+
+// RetryCfg is the retry policy for requests in http mode. Each retry goes
+// to a backend the request has not tried yet.
+type RetryCfg struct {
+	// Total tries per request including the first, 1 disables retries
+	Attempts int `yaml:"attempts" json:"attempts" toml:"attempts"`
+	// "connect-failure" and/or HTTP status codes such as "503"
+	RetryOn []string `yaml:"retry_on" json:"retry_on" toml:"retry_on"`
+	// Retry POST, PATCH and other non-idempotent methods too
+	NonIdempotent bool `yaml:"non_idempotent" json:"non_idempotent" toml:"non_idempotent"`
+	// Time to response headers for each try, retried when exceeded. 0 = none
+	PerTryTimeoutMs int `yaml:"per_try_timeout_ms" json:"per_try_timeout_ms" toml:"per_try_timeout_ms"`
+	// Limit for the whole request including retries. 0 = none
+	TimeoutMs int `yaml:"timeout_ms" json:"timeout_ms" toml:"timeout_ms"`
+	// Retries in flight may not exceed this percentage of requests in
+	// flight, but BudgetMinRetries are always allowed
+	BudgetPercent    int `yaml:"budget_percent" json:"budget_percent" toml:"budget_percent"`
+	BudgetMinRetries int `yaml:"budget_min_retries" json:"budget_min_retries" toml:"budget_min_retries"`
+}
+
+// WebSocketCfg bounds upgraded connections, which usually sit quiet far
+// longer than HTTP requests.
+type WebSocketCfg struct {
+	ClientIdleSec  int `yaml:"client_idle_sec" json:"client_idle_sec" toml:"client_idle_sec"`
+	BackendIdleSec int `yaml:"backend_idle_sec" json:"backend_idle_sec" toml:"backend_idle_sec"`
+}
+
+// HTTPRouteCfg matches requests in http mode. Empty fields match anything.
+type HTTPRouteCfg struct {
+	Host       string            `yaml:"host" json:"host" toml:"host"`
+	PathPrefix string            `yaml:"path_prefix" json:"path_prefix" toml:"path_prefix"`
+	PathRegex  string            `yaml:"path_regex" json:"path_regex" toml:"path_regex"`
+	Methods    []string          `yaml:"methods" json:"methods" toml:"methods"`
+	Headers    map[string]string `yaml:"headers" json:"headers" toml:"headers"`
+	Pool       string            `yaml:"pool" json:"pool" toml:"pool"`
+}
+
+type AcceptProxyCfg struct {
+	Enabled      bool     `yaml:"enabled" json:"enabled" toml:"enabled"`
+	TrustedCIDRs []string `yaml:"trusted_cidrs" json:"trusted_cidrs" toml:"trusted_cidrs"`
+	TimeoutSec   int      `yaml:"timeout_sec" json:"timeout_sec" toml:"timeout_sec"`
+}
+
+type TLSCfg struct {
+	Enabled             bool      `yaml:"enabled" json:"enabled" toml:"enabled"`
+	Certificates        []CertCfg `yaml:"certificates" json:"certificates" toml:"certificates"`
+	MinVersion          string    `yaml:"min_version" json:"min_version" toml:"min_version"`
+	CipherSuites        []string  `yaml:"cipher_suites" json:"cipher_suites" toml:"cipher_suites"`
+	HandshakeTimeoutSec int       `yaml:"handshake_timeout_sec" json:"handshake_timeout_sec" toml:"handshake_timeout_sec"`
+	ReloadIntervalSec   int       `yaml:"reload_interval_sec" json:"reload_interval_sec" toml:"reload_interval_sec"`
 }
 
+type CertCfg struct {
+	CertFile string `yaml:"cert_file" json:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" json:"key_file" toml:"key_file"`
+}
+
+// HealthCfg configures the active TCP connect checks of every pool of a
+// frontend.
 type HealthCfg struct {
+	// Defaults to true; turn off for backends with nothing to connect to,
+	// such as UDP-only services
+	Enabled     *bool `yaml:"enabled" json:"enabled" toml:"enabled"`
+	IntervalSec int   `yaml:"interval_sec" json:"interval_sec" toml:"interval_sec"`
+	TimeoutSec  int   `yaml:"timeout_sec" json:"timeout_sec" toml:"timeout_sec"`
+	Retries     int   `yaml:"retries" json:"retries" toml:"retries"`
+	// Checks dial this port instead of the backend's, e.g. a TCP status
+	// port next to a UDP service. 0 keeps the backend's port
+	Port int `yaml:"port" json:"port" toml:"port"`
+}
+
+// OutlierCfg ejects backends based on what the tcp proxy sees of their
+// connections, on top of the active health checks.
+type OutlierCfg struct {
+	Enabled bool `yaml:"enabled" json:"enabled" toml:"enabled"`
+	// How often latency outliers are looked for and ejections expire
 	IntervalSec int `yaml:"interval_sec" json:"interval_sec" toml:"interval_sec"`
-	TimeoutSec  int `yaml:"timeout_sec" json:"timeout_sec" toml:"timeout_sec"`
-	Retries     int `yaml:"retries" json:"retries" toml:"retries"`
+	// Dial failures in a row that eject a backend
+	ConsecutiveConnectFailures int `yaml:"consecutive_connect_failures" json:"consecutive_connect_failures" toml:"consecutive_connect_failures"`
+	// Connections reset by the backend within ResetWindowMs of connecting,
+	// in a row, that eject it
+	ConsecutiveResets int `yaml:"consecutive_resets" json:"consecutive_resets" toml:"consecutive_resets"`
+	ResetWindowMs     int `yaml:"reset_window_ms" json:"reset_window_ms" toml:"reset_window_ms"`
+	// Eject backends whose connect latency exceeds this multiple of the
+	// pool median. 0 disables
+	LatencyFactor float64 `yaml:"latency_factor" json:"latency_factor" toml:"latency_factor"`
+	// First ejection time, doubled on every further ejection up to the max
+	BaseEjectionSec int `yaml:"base_ejection_sec" json:"base_ejection_sec" toml:"base_ejection_sec"`
+	MaxEjectionSec  int `yaml:"max_ejection_sec" json:"max_ejection_sec" toml:"max_ejection_sec"`
+	// Share of a pool's backends that may be ejected at once; one may
+	// always be, unless it is the last available
+	MaxEjectionPercent int `yaml:"max_ejection_percent" json:"max_ejection_percent" toml:"max_ejection_percent"`
 }
 
 type TimeoutCfg struct {
@@ -82,6 +323,11 @@ func Load(filename string) (*Config, error) {
 		return nil, fmt.Errorf("unsupported file format %s", ext)
 	}
 
+	// Top-level settings would be dropped in favour of the frontends
+	if len(cfg.Frontends) > 0 && !reflect.ValueOf(cfg.FrontendCfg).IsZero() {
+		return nil, errors.New("top-level frontend settings such as listen_address, backends and algorithm cannot be combined with frontends")
+	}
+
 	cfg.applyDefaults()
 
 	if err := cfg.validate(); err != nil {
@@ -92,6 +338,42 @@ func Load(filename string) (*Config, error) {
 }
 
 func (c *Config) validate() error {
+	if len(c.Frontends) == 0 {
+		return errors.New("no frontends configured")
+	}
+
+	names := make(map[string]bool)
+	listeners := make(map[string]bool)
+	for i := range c.Frontends {
+		f := &c.Frontends[i]
+		if f.Name == "" {
+			return fmt.Errorf("frontend %d has no name", i)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("duplicate frontend name: %s", f.Name)
+		}
+		names[f.Name] = true
+
+		// tcp, http and grpc frontends all bind a TCP port
+		transport := "tcp"
+		if f.Protocol == "udp" {
+			transport = "udp"
+		}
+		listener := transport + "://" + f.ListenAddress
+		if listeners[listener] {
+			return fmt.Errorf("frontend %s: listen address %s is already in use", f.Name, f.ListenAddress)
+		}
+		listeners[listener] = true
+
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("frontend %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *FrontendCfg) validate() error {
 	if c.ListenAddress == "" {
 		return errors.New("listen Address is empty")
 	}
@@ -101,42 +383,368 @@ func (c *Config) validate() error {
 		return errors.New("no backends specified for static discovery")
 	}
 
+	switch c.Protocol {
+	case "tcp":
+	case "udp":
+		if c.AcceptProxy.Enabled {
+			return errors.New("accept_proxy is not supported for udp")
+		}
+		if c.TLS.Enabled {
+			return errors.New("tls is not supported for udp")
+		}
+		if len(c.SNIRoutes) > 0 {
+			return errors.New("sni_routes are not supported for udp")
+		}
+	case "http":
+		if c.AcceptProxy.Enabled {
+			return errors.New("accept_proxy is not supported for http")
+		}
+		if len(c.SNIRoutes) > 0 {
+			return errors.New("sni_routes are not supported for http, use http_routes")
+		}
+	case "grpc":
+		if c.AcceptProxy.Enabled {
+			return errors.New("accept_proxy is not supported for grpc")
+		}
+		if len(c.SNIRoutes) > 0 {
+			return errors.New("sni_routes are not supported for grpc, use http_routes")
+		}
+		if c.HTTP.BackendProtocol != BackendH2C {
+			return errors.New("grpc requires http backend_protocol h2c")
+		}
+	default:
+		return fmt.Errorf("invalid protocol: %s", c.Protocol)
+	}
+
+	switch c.HTTP.BackendProtocol {
+	case BackendHTTP1, BackendH2C:
+	default:
+		return fmt.Errorf("invalid http backend_protocol: %s", c.HTTP.BackendProtocol)
+	}
+
+	if err := c.HTTP.Retry.validate(); err != nil {
+		return err
+	}
+
+	if len(c.HTTPRoutes) > 0 && c.Protocol != "http" && c.Protocol != "grpc" {
+		return errors.New("http_routes require protocol http or grpc")
+	}
+	for i, route := range c.HTTPRoutes {
+		if _, ok := c.Pools[route.Pool]; !ok && route.Pool != DefaultPool {
+			return fmt.Errorf("http route %d refers to unknown pool %s", i, route.Pool)
+		}
+		if route.PathRegex != "" {
+			if _, err := regexp.Compile(route.PathRegex); err != nil {
+				return fmt.Errorf("http route %d has an invalid path_regex: %w", i, err)
+			}
+		}
+	}
+
 	validModes := map[string]bool{
 		"round_robin":       true,
 		"least_connections": true,
 		"weighted":          true,
 		"ip_hash":           true,
+		"p2c":               true,
+		"peak_ewma":         true,
+		"maglev":            true,
+		"ring_hash":         true,
+		"smooth_weighted":   true,
 	}
 
 	if !validModes[c.Algorithm] {
 		return errors.New("invalid load balancing algorithm")
 	}
+	if c.RingHash.VirtualNodes < 1 || c.RingHash.Epsilon < 0 {
+		return errors.New("ring_hash needs virtual_nodes >= 1 and epsilon >= 0")
+	}
+	if err := c.Sticky.validate(c.Protocol); err != nil {
+		return err
+	}
+	if err := c.Outlier.validate(c.Protocol); err != nil {
+		return err
+	}
+	if c.SlowStart.WindowSec < 0 || c.SlowStart.Aggression <= 0 ||
+		c.SlowStart.MinWeightPercent <= 0 || c.SlowStart.MinWeightPercent > 100 {
+		return errors.New("slow_start needs window_sec >= 0, aggression > 0 and min_weight_percent in (0, 100]")
+	}
+	if f := c.Failover.OverprovisioningFactor; f != 0 && f < 1 {
+		return errors.New("failover overprovisioning_factor must be 0 or at least 1")
+	}
+
+	for name, pool := range c.Pools {
+		if name == DefaultPool {
+			return fmt.Errorf("pool name %q is reserved for the top-level backends", DefaultPool)
+		}
+		if !validModes[pool.Algorithm] {
+			return fmt.Errorf("invalid load balancing algorithm for pool %s", name)
+		}
+		if pool.Discovery.Type == "static" && len(pool.Backends) == 0 {
+			return fmt.Errorf("no backends specified for static pool %s", name)
+		}
+		if err := pool.Discovery.validate(); err != nil {
+			return fmt.Errorf("pool %s: %w", name, err)
+		}
+		for _, b := range pool.Backends {
+			if err := b.validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, route := range c.SNIRoutes {
+		if route.ServerName == "" {
+			return errors.New("sni route is missing server_name")
+		}
+		if _, ok := c.Pools[route.Pool]; !ok && route.Pool != DefaultPool {
+			return fmt.Errorf("sni route %s refers to unknown pool %s", route.ServerName, route.Pool)
+		}
+	}
+
+	if c.HealthCheck.Port < 0 || c.HealthCheck.Port > 65535 {
+		return fmt.Errorf("invalid health_check port: %d", c.HealthCheck.Port)
+	}
+
+	if c.ConnectRetries < 0 {
+		return errors.New("connect_retries cannot be negative")
+	}
+
+	if !proxyproto.ValidVersion(c.SendProxy) {
+		return fmt.Errorf("invalid send_proxy: %s", c.SendProxy)
+	}
+	for _, b := range c.Backends {
+		if err := b.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.AcceptProxy.Enabled {
+		if len(c.AcceptProxy.TrustedCIDRs) == 0 {
+			return errors.New("accept_proxy requires at least one trusted CIDR")
+		}
+		for _, cidr := range c.AcceptProxy.TrustedCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("invalid accept_proxy trusted CIDR %s: %w", cidr, err)
+			}
+		}
+	}
+
+	if c.TLS.Enabled {
+		if len(c.TLS.Certificates) == 0 {
+			return errors.New("tls requires at least one certificate")
+		}
+		for _, cert := range c.TLS.Certificates {
+			if cert.CertFile == "" || cert.KeyFile == "" {
+				return errors.New("tls certificates need both cert_file and key_file")
+			}
+		}
+		switch c.TLS.MinVersion {
+		case "1.0", "1.1", "1.2", "1.3":
+		default:
+			return fmt.Errorf("invalid tls min_version: %s", c.TLS.MinVersion)
+		}
+	}
+
+	return c.Discovery.validate()
+}
 
-	switch c.Discovery.Type {
+func (d *DiscoveryCfg) validate() error {
+	switch d.Type {
 	case "docker":
-		if c.Discovery.Docker == nil {
+		if d.Docker == nil {
 			return errors.New("docker discovery selected but config is missing")
 		}
 	case "kubernetes":
-		if c.Discovery.Kubernetes == nil {
+		if d.Kubernetes == nil {
 			return errors.New("kubernetes discovery selected but config is missing")
 		}
-		if c.Discovery.Kubernetes.Namespace == "" || c.Discovery.Kubernetes.Service == "" {
+		if d.Kubernetes.Namespace == "" || d.Kubernetes.Service == "" {
 			return errors.New("kubernetes discovery requires namespace and service")
 		}
 	case "static":
 	default:
-		return fmt.Errorf("invalid discovery type: %s", c.Discovery.Type)
+		return fmt.Errorf("invalid discovery type: %s", d.Type)
 	}
-
 	return nil
 }
 
 func (c *Config) applyDefaults() {
+	if len(c.Frontends) == 0 {
+		single := c.FrontendCfg
+		if single.Name == "" {
+			single.Name = DefaultFrontend
+		}
+		c.Frontends = []FrontendCfg{single}
+	}
+
+	for i := range c.Frontends {
+		c.Frontends[i].applyDefaults()
+	}
+}
+
+func (r *RetryCfg) validate() error {
+	if r.Attempts < 1 {
+		return errors.New("retry attempts must be at least 1")
+	}
+	for _, on := range r.RetryOn {
+		if on == RetryConnectFailure {
+			continue
+		}
+		if code, err := strconv.Atoi(on); err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid retry_on value: %s", on)
+		}
+	}
+	if r.PerTryTimeoutMs < 0 || r.TimeoutMs < 0 {
+		return errors.New("retry timeouts must not be negative")
+	}
+	if r.BudgetPercent < 0 || r.BudgetPercent > 100 {
+		return errors.New("retry budget_percent must be between 0 and 100")
+	}
+	return nil
+}
+
+func (s *StickyCfg) validate(protocol string) error {
+	if s.TTLSec < 1 || s.MaxEntries < 1 {
+		return errors.New("sticky needs ttl_sec >= 1 and max_entries >= 1")
+	}
+	if s.Key == StickyClientIP {
+		return nil
+	}
+	kind, name, _ := strings.Cut(s.Key, ":")
+	if kind != "header" && kind != "cookie" || name == "" {
+		return fmt.Errorf("invalid sticky key: %s", s.Key)
+	}
+	if protocol != "http" && protocol != "grpc" {
+		return fmt.Errorf("sticky key %s requires protocol http or grpc", s.Key)
+	}
+	return nil
+}
+
+func (o *OutlierCfg) validate(protocol string) error {
+	if !o.Enabled {
+		return nil
+	}
+	if protocol != "tcp" {
+		return errors.New("outlier_detection requires protocol tcp")
+	}
+	if o.IntervalSec < 1 || o.ConsecutiveConnectFailures < 1 || o.ConsecutiveResets < 1 || o.ResetWindowMs < 1 {
+		return errors.New("outlier_detection interval, consecutive limits and reset window must be at least 1")
+	}
+	if o.LatencyFactor != 0 && o.LatencyFactor <= 1 {
+		return errors.New("outlier_detection latency_factor must be above 1, or 0 to disable")
+	}
+	if o.BaseEjectionSec < 1 || o.MaxEjectionSec < o.BaseEjectionSec {
+		return errors.New("outlier_detection needs base_ejection_sec >= 1 and max_ejection_sec >= base_ejection_sec")
+	}
+	if o.MaxEjectionPercent < 0 || o.MaxEjectionPercent > 100 {
+		return errors.New("outlier_detection max_ejection_percent must be between 0 and 100")
+	}
+	return nil
+}
 
+func (c *FrontendCfg) applyDefaults() {
+	if c.Protocol == "" {
+		c.Protocol = "tcp"
+	}
+	c.Protocol = strings.ToLower(c.Protocol)
 	if c.Algorithm == "" {
 		c.Algorithm = "round_robin"
 	}
+	if c.RingHash.VirtualNodes == 0 {
+		c.RingHash.VirtualNodes = 100
+	}
+	if c.RingHash.Epsilon == 0 {
+		c.RingHash.Epsilon = 0.25
+	}
+	if c.P2C.Weighted == nil {
+		weighted := true
+		c.P2C.Weighted = &weighted
+	}
+	if c.Outlier.IntervalSec == 0 {
+		c.Outlier.IntervalSec = 10
+	}
+	if c.Outlier.ConsecutiveConnectFailures == 0 {
+		c.Outlier.ConsecutiveConnectFailures = 5
+	}
+	if c.Outlier.ConsecutiveResets == 0 {
+		c.Outlier.ConsecutiveResets = 5
+	}
+	if c.Outlier.ResetWindowMs == 0 {
+		c.Outlier.ResetWindowMs = 1000
+	}
+	if c.Outlier.BaseEjectionSec == 0 {
+		c.Outlier.BaseEjectionSec = 30
+	}
+	if c.Outlier.MaxEjectionSec == 0 {
+		c.Outlier.MaxEjectionSec = 300
+	}
+	if c.Outlier.MaxEjectionPercent == 0 {
+		c.Outlier.MaxEjectionPercent = 10
+	}
+	if c.SlowStart.Aggression == 0 {
+		c.SlowStart.Aggression = 1
+	}
+	if c.SlowStart.MinWeightPercent == 0 {
+		c.SlowStart.MinWeightPercent = 10
+	}
+	if c.Sticky.Key == "" {
+		c.Sticky.Key = StickyClientIP
+	}
+	if c.Sticky.TTLSec == 0 {
+		c.Sticky.TTLSec = 600
+	}
+	if c.Sticky.MaxEntries == 0 {
+		c.Sticky.MaxEntries = 100000
+	}
+	for name, pool := range c.Pools {
+		if pool.Algorithm == "" {
+			pool.Algorithm = "round_robin"
+		}
+		pool.Discovery.applyDefaults()
+		c.Pools[name] = pool
+	}
+	for i := range c.SNIRoutes {
+		if c.SNIRoutes[i].Pool == "" {
+			c.SNIRoutes[i].Pool = DefaultPool
+		}
+	}
+	if c.Protocol == "grpc" {
+		// gRPC is HTTP/2 only, so plaintext clients must use prior knowledge
+		c.HTTP.H2C = true
+		if c.HTTP.BackendProtocol == "" {
+			c.HTTP.BackendProtocol = BackendH2C
+		}
+	}
+	if c.HTTP.BackendProtocol == "" {
+		c.HTTP.BackendProtocol = BackendHTTP1
+	}
+	if c.HTTP.Retry.Attempts == 0 {
+		c.HTTP.Retry.Attempts = 1
+	}
+	if len(c.HTTP.Retry.RetryOn) == 0 {
+		c.HTTP.Retry.RetryOn = []string{RetryConnectFailure, "502", "503", "504"}
+	}
+	if c.HTTP.Retry.BudgetPercent == 0 {
+		c.HTTP.Retry.BudgetPercent = 20
+	}
+	if c.HTTP.Retry.BudgetMinRetries == 0 {
+		c.HTTP.Retry.BudgetMinRetries = 3
+	}
+	if c.HTTP.WebSocket.ClientIdleSec == 0 {
+		c.HTTP.WebSocket.ClientIdleSec = 300
+	}
+	if c.HTTP.WebSocket.BackendIdleSec == 0 {
+		c.HTTP.WebSocket.BackendIdleSec = 300
+	}
+	for i := range c.HTTPRoutes {
+		if c.HTTPRoutes[i].Pool == "" {
+			c.HTTPRoutes[i].Pool = DefaultPool
+		}
+	}
+	if c.HealthCheck.Enabled == nil {
+		enabled := true
+		c.HealthCheck.Enabled = &enabled
+	}
 	if c.HealthCheck.IntervalSec == 0 {
 		c.HealthCheck.IntervalSec = 5
 	}
@@ -155,9 +763,24 @@ func (c *Config) applyDefaults() {
 	if c.Timeout.ConnectTimeout == 0 {
 		c.Timeout.ConnectTimeout = 3
 	}
+	if c.AcceptProxy.TimeoutSec == 0 {
+		c.AcceptProxy.TimeoutSec = 3
+	}
+	if c.TLS.MinVersion == "" {
+		c.TLS.MinVersion = "1.2"
+	}
+	if c.TLS.HandshakeTimeoutSec == 0 {
+		c.TLS.HandshakeTimeoutSec = 5
+	}
+	if c.TLS.ReloadIntervalSec == 0 {
+		c.TLS.ReloadIntervalSec = 5
+	}
+	c.Discovery.applyDefaults()
+}
 
-	if c.Discovery.Type == "" {
-		c.Discovery.Type = "static"
+func (d *DiscoveryCfg) applyDefaults() {
+	if d.Type == "" {
+		d.Type = "static"
 	}
-	c.Discovery.Type = strings.ToLower(c.Discovery.Type)
+	d.Type = strings.ToLower(d.Type)
 }
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// load writes content to a config file named name and loads it.
+func load(t *testing.T, name, content string) (*Config, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return Load(path)
+}
+
+func TestLoadSingleFrontend(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "config.yaml", `
+listen_address: ":8080"
+backends:
+  - address: "10.0.0.1:80"
+`},
+		{"json", "config.json", `{"listen_address": ":8080", "backends": [{"address": "10.0.0.1:80"}]}`},
+		{"toml", "config.toml", `
+listen_address = ":8080"
+[[backends]]
+address = "10.0.0.1:80"
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := load(t, tt.file, tt.content)
+			if err != nil {
+				t.Fatalf("Failed to load: %v", err)
+			}
+			if len(cfg.Frontends) != 1 {
+				t.Fatalf("Expected the top-level settings as 1 frontend, got %d", len(cfg.Frontends))
+			}
+			f := cfg.Frontends[0]
+			if f.Name != DefaultFrontend || f.ListenAddress != ":8080" {
+				t.Errorf("Expected frontend %s on :8080, got %s on %s", DefaultFrontend, f.Name, f.ListenAddress)
+			}
+			if len(f.Backends) != 1 || f.Backends[0].Address != "10.0.0.1:80" {
+				t.Errorf("Expected backend 10.0.0.1:80, got %+v", f.Backends)
+			}
+		})
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := load(t, "config.yaml", `
+frontends:
+  - name: "web"
+    listen_address: ":8080"
+    backends: [{address: "10.0.0.1:80"}]
+    pools:
+      static:
+        backends: [{address: "10.0.0.2:80"}]
+    sni_routes:
+      - server_name: "static.example.com"
+  - name: "rpc"
+    listen_address: ":9090"
+    protocol: "GRPC"
+    backends: [{address: "10.0.1.1:9090"}]
+`)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	web, rpc := cfg.Frontends[0], cfg.Frontends[1]
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"protocol", web.Protocol, "tcp"},
+		{"algorithm", web.Algorithm, "round_robin"},
+		{"pool algorithm", web.Pools["static"].Algorithm, "round_robin"},
+		{"pool discovery", web.Pools["static"].Discovery.Type, "static"},
+		{"discovery", web.Discovery.Type, "static"},
+		{"sni route pool", web.SNIRoutes[0].Pool, DefaultPool},
+		{"ring hash virtual nodes", web.RingHash.VirtualNodes, 100},
+		{"ring hash epsilon", web.RingHash.Epsilon, 0.25},
+		{"p2c weighted", *web.P2C.Weighted, true},
+		{"health check enabled", *web.HealthCheck.Enabled, true},
+		{"health check interval", web.HealthCheck.IntervalSec, 5},
+		{"connect timeout", web.Timeout.ConnectTimeout, 3},
+		{"sticky key", web.Sticky.Key, StickyClientIP},
+		{"backend protocol", web.HTTP.BackendProtocol, BackendHTTP1},
+		{"retry attempts", web.HTTP.Retry.Attempts, 1},
+		{"tls min version", web.TLS.MinVersion, "1.2"},
+		{"grpc protocol", rpc.Protocol, "grpc"},
+		{"grpc h2c", rpc.HTTP.H2C, true},
+		{"grpc backend protocol", rpc.HTTP.BackendProtocol, BackendH2C},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, tt.got)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string // empty for a valid config
+	}{
+		{"no listen address", `
+backends: [{address: "10.0.0.1:80"}]
+`, "listen Address is empty"},
+		{"frontends with top-level listen address", `
+listen_address: ":8080"
+frontends:
+  - {name: "web", listen_address: ":8081", backends: [{address: "10.0.0.1:80"}]}
+`, "cannot be combined with frontends"},
+		{"frontends with top-level backends", `
+backends: [{address: "10.0.0.9:80"}]
+frontends:
+  - {name: "web", listen_address: ":8081", backends: [{address: "10.0.0.1:80"}]}
+`, "cannot be combined with frontends"},
+		{"frontends with top-level algorithm", `
+algorithm: "least_connections"
+frontends:
+  - {name: "web", listen_address: ":8081", backends: [{address: "10.0.0.1:80"}]}
+`, "cannot be combined with frontends"},
+		{"frontend without name", `
+frontends:
+  - {listen_address: ":8081", backends: [{address: "10.0.0.1:80"}]}
+`, "frontend 0 has no name"},
+		{"duplicate names", `
+frontends:
+  - {name: "web", listen_address: ":8081", backends: [{address: "10.0.0.1:80"}]}
+  - {name: "web", listen_address: ":8082", backends: [{address: "10.0.0.2:80"}]}
+`, "duplicate frontend name: web"},
+		{"duplicate listeners", `
+frontends:
+  - {name: "web", listen_address: ":8081", backends: [{address: "10.0.0.1:80"}]}
+  - {name: "api", listen_address: ":8081", backends: [{address: "10.0.0.2:80"}]}
+`, "listen address :8081 is already in use"},
+		{"tcp and http on one port", `
+frontends:
+  - {name: "web", listen_address: ":8081", backends: [{address: "10.0.0.1:80"}]}
+  - {name: "api", listen_address: ":8081", protocol: "http", backends: [{address: "10.0.0.2:80"}]}
+`, "listen address :8081 is already in use"},
+		{"tcp and udp on one port", `
+frontends:
+  - {name: "dns-tcp", listen_address: ":5353", backends: [{address: "10.0.0.1:53"}]}
+  - {name: "dns-udp", listen_address: ":5353", protocol: "udp", backends: [{address: "10.0.0.1:53"}]}
+`, ""},
+		{"invalid algorithm", `
+listen_address: ":8080"
+algorithm: "random"
+backends: [{address: "10.0.0.1:80"}]
+`, "invalid load balancing algorithm"},
+		{"invalid pool algorithm", `
+listen_address: ":8080"
+backends: [{address: "10.0.0.1:80"}]
+pools:
+  static: {algorithm: "random", backends: [{address: "10.0.0.2:80"}]}
+`, "invalid load balancing algorithm for pool static"},
+		{"reserved pool name", `
+listen_address: ":8080"
+backends: [{address: "10.0.0.1:80"}]
+pools:
+  default: {backends: [{address: "10.0.0.2:80"}]}
+`, "is reserved"},
+		{"static pool without backends", `
+listen_address: ":8080"
+backends: [{address: "10.0.0.1:80"}]
+pools:
+  static: {}
+`, "no backends specified for static pool static"},
+		{"unknown sni pool", `
+listen_address: ":8080"
+backends: [{address: "10.0.0.1:80"}]
+sni_routes:
+  - {server_name: "a.example.com", pool: "missing"}
+`, "refers to unknown pool missing"},
+		{"unknown http pool", `
+listen_address: ":8080"
+protocol: "http"
+backends: [{address: "10.0.0.1:80"}]
+http_routes:
+  - {path_prefix: "/static", pool: "missing"}
+`, "refers to unknown pool missing"},
+		{"invalid health check port", `
+listen_address: ":8080"
+backends: [{address: "10.0.0.1:80"}]
+health_check: {port: 70000}
+`, "invalid health_check port"},
+		{"invalid protocol", `
+listen_address: ":8080"
+protocol: "sctp"
+backends: [{address: "10.0.0.1:80"}]
+`, "invalid protocol: sctp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(t, "config.yaml", tt.content)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Expected a valid config, got %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadUnsupportedFormat(t *testing.T) {
+	if _, err := load(t, "config.ini", "listen_address = :8080"); err == nil || !strings.Contains(err.Error(), "unsupported file format") {
+		t.Errorf("Expected an unsupported format error, got %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"LoadBalancer/internal/logging"
 	"context"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -36,7 +37,7 @@ func (c *Checker) checkBackend(backend *backend.Backend) {
 		Timeout: time.Duration(c.config.TimeoutSec) * time.Second,
 	}
 
-	conn, err := dialer.DialContext(c.ctx, "tcp", backend.Address)
+	conn, err := dialer.DialContext(c.ctx, "tcp", c.target(backend.Address))
 	if err != nil {
 		failures := backend.AddFailures()
 		if failures >= int32(c.config.Retries) {
@@ -52,6 +53,18 @@ func (c *Checker) checkBackend(backend *backend.Backend) {
 	}
 }
 
+// target is the address checks of a backend at address dial.
+func (c *Checker) target(address string) string {
+	if c.config.Port == 0 {
+		return address
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return net.JoinHostPort(host, strconv.Itoa(c.config.Port))
+}
+
 func (c *Checker) runOnce() {
 	backends := c.pool.GetBackends()
 	for _, backend := range backends {
@@ -0,0 +1,46 @@
+package health
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/config"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestCheckerPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// Port 1 is closed, only the status port answers
+	tests := []struct {
+		name  string
+		port  int
+		alive bool
+	}{
+		{"backend port", 0, false},
+		{"status port", port, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := backend.NewPool()
+			b, _ := pool.AddBackend("127.0.0.1:1", 1)
+			c := New(pool, config.HealthCfg{TimeoutSec: 1, Retries: 1, Port: tt.port})
+
+			c.wg.Add(1)
+			c.checkBackend(b)
+			if b.IsAlive() != tt.alive {
+				t.Errorf("Expected alive %v checking %s, got %v", tt.alive, c.target(b.Address), b.IsAlive())
+			}
+		})
+	}
+
+	c := New(backend.NewPool(), config.HealthCfg{Port: port})
+	if got, want := c.target("[::1]:53"), net.JoinHostPort("::1", strconv.Itoa(port)); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,255 @@
+package health
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/logging"
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Connect latency samples a backend needs, and backends with enough of
+// them a pool needs, before latency outliers are looked for.
+const (
+	outlierMinSamples = 5
+	outlierMinHosts   = 3
+)
+
+// latencyAlpha is the weight of a new sample in the connect latency EWMA.
+const latencyAlpha = 0.3
+
+// Reasons a backend is ejected
+const (
+	ejectConnectFailures = "consecutive_connect_failures"
+	ejectResets          = "consecutive_resets"
+	ejectLatency         = "latency_outlier"
+)
+
+// Detector ejects backends passively, from how the proxy's connections to
+// them go: dial failures or early resets in a row, or a connect latency far
+// above the rest of the pool. Ejected backends are readmitted after an
+// ejection time that doubles every time they are ejected again, and halves
+// back towards the base for every interval they stay in.
+//
+// Connections only update counters on the backend; the lock is taken by
+// sweep and when a backend crosses a threshold.
+type Detector struct {
+	pools  []*backend.Pool
+	config config.OutlierCfg
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	hosts map[*backend.Backend]*ejectionState
+}
+
+type ejectionState struct {
+	ejections    int // doubles the ejection time, decays while in
+	ejectedUntil time.Time
+}
+
+func NewDetector(config config.OutlierCfg, pools ...*backend.Pool) *Detector {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Detector{
+		pools:  pools,
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		hosts:  make(map[*backend.Backend]*ejectionState),
+	}
+}
+
+// state returns b's ejection state. Must be called with d.mu held.
+func (d *Detector) state(b *backend.Backend) *ejectionState {
+	s, ok := d.hosts[b]
+	if !ok {
+		s = &ejectionState{}
+		d.hosts[b] = s
+	}
+	return s
+}
+
+// ConnectFailed records a failed dial to b.
+func (d *Detector) ConnectFailed(b *backend.Backend) {
+	if b.Outlier().ConnectFailures.Add(1) >= int64(d.config.ConsecutiveConnectFailures) {
+		d.mu.Lock()
+		d.eject(b, ejectConnectFailures, time.Now())
+		d.mu.Unlock()
+	}
+}
+
+// Connected records a successful dial to b that took rtt.
+func (d *Detector) Connected(b *backend.Backend, rtt time.Duration) {
+	stats := b.Outlier()
+	stats.ConnectFailures.Store(0)
+	stats.ObserveLatency(rtt, latencyAlpha)
+}
+
+// Closed records the end of a connection to b that lasted lifetime, and
+// whether the backend reset it.
+func (d *Detector) Closed(b *backend.Backend, lifetime time.Duration, reset bool) {
+	stats := b.Outlier()
+	if !reset || lifetime >= time.Duration(d.config.ResetWindowMs)*time.Millisecond {
+		stats.Resets.Store(0)
+		return
+	}
+	if stats.Resets.Add(1) >= int64(d.config.ConsecutiveResets) {
+		d.mu.Lock()
+		d.eject(b, ejectResets, time.Now())
+		d.mu.Unlock()
+	}
+}
+
+// eject takes b out of rotation unless its pool already has as many
+// backends ejected as allowed. Must be called with d.mu held.
+func (d *Detector) eject(b *backend.Backend, reason string, now time.Time) bool {
+	if b.IsEjected() {
+		return false
+	}
+	pool := d.poolOf(b)
+	if pool == nil {
+		return false
+	}
+
+	backends := pool.GetBackends()
+	ejected, available := 0, 0
+	for _, other := range backends {
+		if other.IsEjected() {
+			ejected++
+		} else if other.IsAlive() {
+			available++
+		}
+	}
+	limit := max(1, len(backends)*d.config.MaxEjectionPercent/100)
+	if ejected >= limit || available <= 1 && b.IsAlive() {
+		logging.L().Warn("outlier not ejected, too many backends out",
+			zap.String("backend_address", b.Address),
+			zap.String("reason", reason),
+			zap.Int("ejected", ejected),
+		)
+		return false
+	}
+
+	s := d.state(b)
+	s.ejections++
+	base := time.Duration(d.config.BaseEjectionSec) * time.Second
+	duration := min(base<<min(s.ejections-1, 30), time.Duration(d.config.MaxEjectionSec)*time.Second)
+	s.ejectedUntil = now.Add(duration)
+	b.Outlier().Reset()
+
+	b.Eject()
+	logging.L().Warn("ejected outlier backend",
+		zap.String("backend_address", b.Address),
+		zap.String("reason", reason),
+		zap.Duration("duration", duration),
+	)
+	return true
+}
+
+func (d *Detector) poolOf(b *backend.Backend) *backend.Pool {
+	for _, p := range d.pools {
+		if found, err := p.GetBackend(b.Address); err == nil && found == b {
+			return p
+		}
+	}
+	return nil
+}
+
+// sweep readmits backends whose ejection is over, decays the ejection
+// count of those in rotation and ejects connect latency outliers.
+func (d *Detector) sweep(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	present := make(map[*backend.Backend]bool)
+	for _, pool := range d.pools {
+		var measured []measurement
+		for _, b := range pool.GetBackends() {
+			present[b] = true
+			s := d.state(b)
+
+			if b.IsEjected() {
+				if now.Before(s.ejectedUntil) {
+					continue
+				}
+				b.Readmit()
+				logging.L().Info("readmitted ejected backend", zap.String("backend_address", b.Address))
+				continue
+			}
+			if s.ejections > 0 {
+				s.ejections--
+			}
+			stats := b.Outlier()
+			if b.IsAlive() && stats.Samples.Load() >= outlierMinSamples {
+				measured = append(measured, measurement{backend: b, latency: stats.Latency()})
+			}
+		}
+		d.ejectSlow(measured, now)
+	}
+
+	// Forget backends that left every pool
+	for b := range d.hosts {
+		if !present[b] {
+			delete(d.hosts, b)
+		}
+	}
+}
+
+// measurement is a backend's connect latency as of the sweep, so sorting
+// does not see it change underneath.
+type measurement struct {
+	backend *backend.Backend
+	latency float64
+}
+
+// ejectSlow ejects the backends, slowest first, whose connect latency is
+// over LatencyFactor times the median of measured. Must be called with
+// d.mu held.
+func (d *Detector) ejectSlow(measured []measurement, now time.Time) {
+	if d.config.LatencyFactor <= 0 || len(measured) < outlierMinHosts {
+		return
+	}
+
+	slices.SortFunc(measured, func(a, b measurement) int {
+		return cmp.Compare(b.latency, a.latency)
+	})
+	median := measured[len(measured)/2].latency
+	if len(measured)%2 == 0 {
+		median = (median + measured[len(measured)/2-1].latency) / 2
+	}
+
+	for _, m := range measured {
+		if m.latency <= d.config.LatencyFactor*median {
+			return
+		}
+		if !d.eject(m.backend, ejectLatency, now) {
+			return
+		}
+	}
+}
+
+func (d *Detector) Start() {
+	logging.L().Info("Outlier Detector Started")
+
+	ticker := time.NewTicker(time.Duration(d.config.IntervalSec) * time.Second)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				d.sweep(now)
+			case <-d.ctx.Done():
+				logging.L().Info("Outlier Detector Stopped")
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package health
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/config"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func outlierCfg() config.OutlierCfg {
+	return config.OutlierCfg{
+		Enabled:                    true,
+		IntervalSec:                10,
+		ConsecutiveConnectFailures: 3,
+		ConsecutiveResets:          3,
+		ResetWindowMs:              1000,
+		LatencyFactor:              3,
+		BaseEjectionSec:            30,
+		MaxEjectionSec:             100,
+		MaxEjectionPercent:         50,
+	}
+}
+
+func poolOf(n int) (*backend.Pool, []*backend.Backend) {
+	pool := backend.NewPool()
+	backends := make([]*backend.Backend, n)
+	for i := range backends {
+		backends[i], _ = pool.AddBackend(fmt.Sprintf("10.0.0.%d:8080", i+1), 1)
+	}
+	return pool, backends
+}
+
+func TestOutlierConnectFailures(t *testing.T) {
+	pool, backends := poolOf(4)
+	d := NewDetector(outlierCfg(), pool)
+	b := backends[0]
+
+	// A successful connect starts the count over
+	d.ConnectFailed(b)
+	d.ConnectFailed(b)
+	d.Connected(b, time.Millisecond)
+	d.ConnectFailed(b)
+	if b.IsEjected() {
+		t.Fatal("Expected the backend to stay in after a successful connect")
+	}
+	d.ConnectFailed(b)
+	d.ConnectFailed(b)
+	if !b.IsEjected() {
+		t.Fatal("Expected the backend to be ejected after 3 failures in a row")
+	}
+	if len(pool.AliveSnapshot()) != 3 {
+		t.Errorf("Expected 3 backends in rotation, got %d", len(pool.AliveSnapshot()))
+	}
+
+	// Readmitted once the ejection time is over
+	start := time.Now()
+	d.sweep(start.Add(29 * time.Second))
+	if !b.IsEjected() {
+		t.Fatal("Expected the backend to still be ejected before 30s")
+	}
+	d.sweep(start.Add(31 * time.Second))
+	if b.IsEjected() {
+		t.Fatal("Expected the backend to be readmitted after 30s")
+	}
+
+	// Every further ejection lasts twice as long, up to the max
+	for _, want := range []time.Duration{60 * time.Second, 100 * time.Second} {
+		ejectedAt := time.Now()
+		for range 3 {
+			d.ConnectFailed(b)
+		}
+		if got := d.hosts[b].ejectedUntil.Sub(ejectedAt).Round(time.Second); got != want {
+			t.Errorf("Expected the ejection to last %v, got %v", want, got)
+		}
+		d.sweep(ejectedAt.Add(want + time.Second))
+	}
+}
+
+func TestOutlierResets(t *testing.T) {
+	pool, backends := poolOf(4)
+	d := NewDetector(outlierCfg(), pool)
+	b := backends[0]
+
+	// Resets after the window and clean closes do not count
+	d.Closed(b, 10*time.Millisecond, true)
+	d.Closed(b, 10*time.Millisecond, true)
+	d.Closed(b, 2*time.Second, true)
+	d.Closed(b, 10*time.Millisecond, true)
+	d.Closed(b, 10*time.Millisecond, false)
+	if b.IsEjected() {
+		t.Fatal("Expected the backend to stay in")
+	}
+
+	for range 3 {
+		d.Closed(b, 10*time.Millisecond, true)
+	}
+	if !b.IsEjected() {
+		t.Error("Expected the backend to be ejected after 3 early resets")
+	}
+}
+
+func TestOutlierLatency(t *testing.T) {
+	pool, backends := poolOf(5)
+	d := NewDetector(outlierCfg(), pool)
+
+	for range outlierMinSamples {
+		for i, b := range backends {
+			rtt := time.Millisecond
+			if i == 2 {
+				rtt = 10 * time.Millisecond
+			}
+			d.Connected(b, rtt)
+		}
+	}
+	d.sweep(time.Now())
+
+	for i, b := range backends {
+		if b.IsEjected() != (i == 2) {
+			t.Errorf("Expected only the slow backend to be ejected, backend %d ejected=%v", i, b.IsEjected())
+		}
+	}
+}
+
+func TestOutlierMaxEjection(t *testing.T) {
+	pool, backends := poolOf(4)
+	d := NewDetector(outlierCfg(), pool)
+
+	// 50% of 4 backends
+	for _, b := range backends {
+		for range 3 {
+			d.ConnectFailed(b)
+		}
+	}
+	ejected := 0
+	for _, b := range backends {
+		if b.IsEjected() {
+			ejected++
+		}
+	}
+	if ejected != 2 {
+		t.Errorf("Expected 2 backends ejected, got %d", ejected)
+	}
+
+	// The last backend in rotation is never ejected
+	single, only := poolOf(1)
+	d = NewDetector(outlierCfg(), single)
+	for range 3 {
+		d.ConnectFailed(only[0])
+	}
+	if only[0].IsEjected() {
+		t.Error("Expected the only backend to stay in")
+	}
+}
+
+func TestOutlierConcurrentConnections(t *testing.T) {
+	pool, backends := poolOf(4)
+	d := NewDetector(outlierCfg(), pool)
+
+	// Proxied connections report without serialising on the detector,
+	// while a sweep runs alongside
+	var wg sync.WaitGroup
+	for _, b := range backends[1:] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				d.Connected(b, time.Millisecond)
+				d.Closed(b, time.Minute, false)
+			}
+		}()
+	}
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				d.ConnectFailed(backends[0])
+			}
+		}()
+	}
+	d.sweep(time.Now())
+	wg.Wait()
+
+	if !backends[0].IsEjected() {
+		t.Error("Expected the failing backend to be ejected")
+	}
+	if got := d.hosts[backends[0]].ejections; got != 1 {
+		t.Errorf("Expected one ejection, got %d", got)
+	}
+	for _, b := range backends[1:] {
+		if b.IsEjected() || b.Outlier().Samples.Load() != 1000 {
+			t.Errorf("Expected %s in rotation with 1000 samples, got %d", b.Address, b.Outlier().Samples.Load())
+		}
+	}
+}
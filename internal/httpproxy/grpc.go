@@ -0,0 +1,119 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gRPC status codes the proxy produces or reacts to.
+const (
+	grpcUnknown          = 2
+	grpcDeadlineExceeded = 4
+	grpcInternal         = 13
+	grpcUnavailable      = 14
+	grpcDataLoss         = 15
+)
+
+func isGRPC(req *http.Request) bool {
+	ct := req.Header.Get("Content-Type")
+	return ct == "application/grpc" ||
+		strings.HasPrefix(ct, "application/grpc+") ||
+		strings.HasPrefix(ct, "application/grpc;")
+}
+
+// grpcTimeoutUnits are tried smallest first so the encoded value keeps as
+// much precision as the 8 digit limit allows.
+var grpcTimeoutUnits = []struct {
+	unit byte
+	size time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// parseGRPCTimeout parses a grpc-timeout header value such as "250m".
+func parseGRPCTimeout(v string) (time.Duration, bool) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	for _, u := range grpcTimeoutUnits {
+		if u.unit == v[len(v)-1] {
+			return time.Duration(n) * u.size, true
+		}
+	}
+	return 0, false
+}
+
+// encodeGRPCTimeout formats d for the grpc-timeout header, rounding down
+// so the backend never gets more time than the client has left.
+func encodeGRPCTimeout(d time.Duration) string {
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	for _, u := range grpcTimeoutUnits {
+		if n := d / u.size; n <= 99999999 {
+			return strconv.FormatInt(max(int64(n), 1), 10) + string(u.unit)
+		}
+	}
+	return "99999999H"
+}
+
+// grpcFailure reports whether code means the backend is broken rather than
+// the call being rejected on its merits.
+func grpcFailure(code int) bool {
+	return code == grpcInternal || code == grpcUnavailable || code == grpcDataLoss
+}
+
+// recordGRPCStatus counts the grpc-status value of a finished call against
+// b and charges server-side failures as passive health check failures.
+func recordGRPCStatus(b *backend.Backend, status string) {
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		code = grpcUnknown
+	}
+	b.AddGRPCStatus(code)
+	if grpcFailure(code) {
+		b.AddFailures()
+	}
+}
+
+// writeGRPCError sends a Trailers-Only response, which is how gRPC servers
+// fail a call before sending any message.
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", message)
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcBody records the grpc-status trailer once the response body has been
+// read to the end; trailers are only available after that.
+type grpcBody struct {
+	io.ReadCloser
+	resp *http.Response
+	b    *backend.Backend
+	done bool
+}
+
+func (g *grpcBody) Read(p []byte) (int, error) {
+	n, err := g.ReadCloser.Read(p)
+	if err == io.EOF && !g.done {
+		g.done = true
+		if status := g.resp.Trailer.Get("Grpc-Status"); status != "" {
+			recordGRPCStatus(g.b, status)
+		}
+	}
+	return n, err
+}
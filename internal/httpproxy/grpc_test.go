@@ -0,0 +1,121 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"250m", 250 * time.Millisecond, true},
+		{"1S", time.Second, true},
+		{"3H", 3 * time.Hour, true},
+		{"100u", 100 * time.Microsecond, true},
+		{"m", 0, false},
+		{"123456789S", 0, false},
+		{"10x", 0, false},
+		{"-1S", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseGRPCTimeout(tt.value)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseGRPCTimeout(%q): expected %v %v, got %v %v", tt.value, tt.want, tt.ok, got, ok)
+		}
+	}
+
+	for _, d := range []time.Duration{time.Nanosecond, 1500 * time.Millisecond, 90 * time.Second, 48 * time.Hour} {
+		encoded := encodeGRPCTimeout(d)
+		got, ok := parseGRPCTimeout(encoded)
+		if !ok || got > d || d-got > d/1000 {
+			t.Errorf("encodeGRPCTimeout(%v) = %q, parsed back as %v", d, encoded, got)
+		}
+	}
+}
+
+// grpcCall makes a unary call with an empty message and returns the
+// response once the trailers have been read.
+func grpcCall(t *testing.T, url, status, timeout string) *http.Response {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", url+"/echo.Echo/Say", strings.NewReader("\x00\x00\x00\x00\x00"))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("X-Status", status)
+	if timeout != "" {
+		req.Header.Set("Grpc-Timeout", timeout)
+	}
+	resp, err := h2cClient().Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestGRPCStatusAndDeadline(t *testing.T) {
+	seenTimeout := make(chan string, 1)
+	// Fake unary backend: finishes with the status the client asks for in
+	// the trailers, or never answers when asked to be slow
+	server := h2cServer(t, func(w http.ResponseWriter, r *http.Request) {
+		seenTimeout <- r.Header.Get("Grpc-Timeout")
+		if r.Header.Get("X-Status") == "slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = w.Write([]byte("\x00\x00\x00\x00\x00"))
+		w.Header().Set("Grpc-Status", r.Header.Get("X-Status"))
+	})
+	pool := poolOf(t, server)
+	b := pool.GetBackends()[0]
+
+	s := startServer(t, balancer.NewRoundRobinBalancer(pool), Options{
+		H2C:             true,
+		BackendProtocol: config.BackendH2C,
+	})
+	url := "http://" + s.listener.Addr().String()
+
+	resp := grpcCall(t, url, "0", "5S")
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Expected grpc-status 0 in the trailers, got %q", got)
+	}
+	got, ok := parseGRPCTimeout(<-seenTimeout)
+	if !ok || got > 5*time.Second || got < 4*time.Second {
+		t.Errorf("Expected the remaining deadline to be propagated, got %v", got)
+	}
+
+	grpcCall(t, url, "14", "")
+	<-seenTimeout
+	if b.Failures() != 1 {
+		t.Errorf("Expected UNAVAILABLE to count as a passive failure, got %d", b.Failures())
+	}
+
+	grpcCall(t, url, "5", "")
+	<-seenTimeout
+	if b.Failures() != 1 {
+		t.Errorf("Expected NOT_FOUND not to count as a failure, got %d", b.Failures())
+	}
+
+	resp = grpcCall(t, url, "slow", "50m")
+	<-seenTimeout
+	if got := resp.Header.Get("Grpc-Status"); got != "4" {
+		t.Errorf("Expected DEADLINE_EXCEEDED from the proxy, got %q", got)
+	}
+
+	counts := b.GRPCStatus()
+	if counts[0] != 1 || counts[4] != 1 || counts[5] != 1 || counts[14] != 1 {
+		t.Errorf("Unexpected grpc-status counts %v", counts)
+	}
+}
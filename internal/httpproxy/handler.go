@@ -0,0 +1,311 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/idle"
+	"LoadBalancer/internal/logging"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Balancer interface {
+	Pick(key string, exclude ...string) (*backend.Backend, error)
+}
+
+// Handler balances each request on its own, so keep-alive clients are
+// spread over the pool instead of being pinned to one backend.
+type Handler struct {
+	balancer  Balancer
+	routes    []route
+	transport *http.Transport
+	proxy     *httputil.ReverseProxy
+	dialer    *net.Dialer
+	ws        *webSockets
+	retry     *retryPolicy
+	keyHeader string // balance on this header, or
+	keyCookie string // on this cookie, instead of the client IP
+}
+
+func NewHandler(balancer Balancer, options Options) (*Handler, error) {
+	compiled, err := compileRoutes(options.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(options.Timeout.ConnectTimeout) * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		MaxIdleConns:        1024,
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     time.Duration(options.Timeout.BackendIdleSec) * time.Second,
+	}
+
+	switch options.BackendProtocol {
+	case "", config.BackendHTTP1:
+	case config.BackendH2C:
+		// Prior-knowledge HTTP/2 over cleartext; requests to one backend are
+		// multiplexed as streams over a few connections
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+	default:
+		return nil, fmt.Errorf("unsupported backend protocol %q", options.BackendProtocol)
+	}
+
+	var keyHeader, keyCookie string
+	if options.Key != "" && options.Key != config.StickyClientIP {
+		kind, name, _ := strings.Cut(options.Key, ":")
+		switch {
+		case name == "":
+			return nil, fmt.Errorf("invalid balancing key %q", options.Key)
+		case kind == "header":
+			keyHeader = http.CanonicalHeaderKey(name)
+		case kind == "cookie":
+			keyCookie = name
+		default:
+			return nil, fmt.Errorf("invalid balancing key %q", options.Key)
+		}
+	}
+
+	h := &Handler{
+		balancer:  balancer,
+		routes:    compiled,
+		transport: transport,
+		dialer:    dialer,
+		retry:     newRetryPolicy(options.Retry),
+		keyHeader: keyHeader,
+		keyCookie: keyCookie,
+		ws: &webSockets{idle: idle.Timeouts{
+			Client:  time.Duration(options.WebSocket.ClientIdleSec) * time.Second,
+			Backend: time.Duration(options.WebSocket.BackendIdleSec) * time.Second,
+		}},
+	}
+	transport.DialContext = h.dial
+	h.proxy = &httputil.ReverseProxy{
+		Rewrite:        h.rewrite,
+		Transport:      &retryTransport{next: transport, policy: h.retry},
+		ModifyResponse: h.modifyResponse,
+		ErrorHandler:   h.proxyError,
+	}
+	return h, nil
+}
+
+// dial connects to a backend, counting the dial against the circuit
+// breaker of the backend the request is for, which may refuse it.
+func (h *Handler) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if c, ok := ctx.Value(callKey{}).(*call); ok && c.backend.Address == address {
+		if err := c.backend.BeginConnect(); err != nil {
+			return nil, err
+		}
+		defer c.backend.EndConnect()
+	}
+	return h.dialer.DialContext(ctx, network, address)
+}
+
+// balancerFor returns the balancer of the first matching route, or the
+// default one.
+func (h *Handler) balancerFor(req *http.Request) Balancer {
+	for i := range h.routes {
+		if h.routes[i].matches(req) {
+			return h.routes[i].Balancer
+		}
+	}
+	return h.balancer
+}
+
+// balanceKey returns what req is balanced on: the configured header or
+// cookie, or the client IP when there is none or the request lacks it.
+func (h *Handler) balanceKey(req *http.Request) string {
+	switch {
+	case h.keyHeader != "":
+		if v := req.Header.Get(h.keyHeader); v != "" {
+			return v
+		}
+	case h.keyCookie != "":
+		if c, err := req.Cookie(h.keyCookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	clientIP, _, _ := net.SplitHostPort(req.RemoteAddr)
+	return clientIP
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key := h.balanceKey(req)
+	grpc := isGRPC(req)
+
+	lb := h.balancerFor(req)
+	b, err := lb.Pick(key)
+	if err != nil {
+		logging.L().Error("failed to pick backend", zap.String("client_address", req.RemoteAddr), zap.Error(err))
+		if grpc {
+			writeGRPCError(w, grpcUnavailable, "no backend available")
+			return
+		}
+		http.Error(w, "no backend available", http.StatusServiceUnavailable)
+		return
+	}
+	c := &call{balancer: lb, key: key, backend: b, tried: []string{b.Address}}
+	// Picking counted the request as in flight on b; retries move that
+	// count along to the backend they end up on
+	defer func() { c.backend.DecConn() }()
+
+	ctx := context.WithValue(req.Context(), callKey{}, c)
+	if isWebSocket(req) {
+		// The session stays counted on b for as long as it is open
+		h.serveWebSocket(w, req.WithContext(ctx), b)
+		return
+	}
+
+	h.retry.active.Add(1)
+	defer h.retry.active.Add(-1)
+	c.retry = h.retry.prepare(req)
+	if h.retry.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.retry.timeout)
+		defer cancel()
+	}
+	if grpc {
+		// Enforce the client's deadline here too, so a stuck backend is
+		// abandoned instead of holding the call open
+		if d, ok := parseGRPCTimeout(req.Header.Get("Grpc-Timeout")); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+	}
+	h.proxy.ServeHTTP(w, req.WithContext(ctx))
+}
+
+func (h *Handler) rewrite(pr *httputil.ProxyRequest) {
+	b := callFrom(pr.In.Context()).backend
+	pr.SetURL(&url.URL{Scheme: "http", Host: b.Address})
+	// Keep the client's Host so name based virtual hosts keep working
+	pr.Out.Host = pr.In.Host
+
+	// Append to the chain built by proxies in front of us
+	pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+	pr.SetXForwarded()
+	pr.Out.Header.Set("Forwarded", forwarded(pr.In))
+
+	// Pass on what is left of the deadline, not the client's original value
+	if deadline, ok := pr.Out.Context().Deadline(); ok && isGRPC(pr.In) {
+		pr.Out.Header.Set("Grpc-Timeout", encodeGRPCTimeout(time.Until(deadline)))
+	}
+}
+
+func (h *Handler) modifyResponse(resp *http.Response) error {
+	if !isGRPC(resp.Request) {
+		return nil
+	}
+	b := callFrom(resp.Request.Context()).backend
+
+	// Trailers-Only responses carry the status in the headers
+	if status := resp.Header.Get("Grpc-Status"); status != "" {
+		recordGRPCStatus(b, status)
+		return nil
+	}
+	resp.Body = &grpcBody{ReadCloser: resp.Body, resp: resp, b: b}
+	return nil
+}
+
+// forwarded appends this hop to the RFC 7239 Forwarded header.
+func forwarded(req *http.Request) string {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	node := "unknown"
+	if ip, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		node = ip
+		if strings.Contains(ip, ":") {
+			node = `"[` + ip + `]"`
+		}
+	}
+
+	elem := "for=" + node + ";host=" + quoteForwarded(req.Host) + ";proto=" + proto
+	if prior := req.Header.Values("Forwarded"); len(prior) > 0 {
+		return strings.Join(prior, ", ") + ", " + elem
+	}
+	return elem
+}
+
+// quoteForwarded quotes values that are not plain tokens, e.g. host:port.
+func quoteForwarded(v string) string {
+	for _, c := range v {
+		if !(c == '-' || c == '.' || c == '_' || c == '~' ||
+			c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+		}
+	}
+	return v
+}
+
+func (h *Handler) proxyError(w http.ResponseWriter, req *http.Request, err error) {
+	b := callFrom(req.Context()).backend
+
+	// The client went away, not the backend's fault. 499 is only seen in
+	// access logs, the client is no longer reading.
+	if errors.Is(err, context.Canceled) {
+		w.WriteHeader(499)
+		return
+	}
+
+	grpc := isGRPC(req)
+	// Refused by the circuit breaker before anything reached the backend
+	if errors.Is(err, backend.ErrOverflow) {
+		logging.L().Warn("backend circuit breaker refused the request",
+			zap.String("backend_address", b.Address),
+			zap.String("path", req.URL.Path),
+			zap.Error(err),
+		)
+		if grpc {
+			writeGRPCError(w, grpcUnavailable, "no backend available")
+			return
+		}
+		http.Error(w, "no backend available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Out of time: the client's gRPC deadline or our own timeouts. Slow is
+	// not down, so this is not a failure of the backend
+	if !isConnectError(err) && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errPerTryTimeout)) {
+		logging.L().Warn("backend request timed out",
+			zap.String("backend_address", b.Address),
+			zap.String("path", req.URL.Path),
+			zap.Error(err),
+		)
+		if grpc {
+			b.AddGRPCStatus(grpcDeadlineExceeded)
+			writeGRPCError(w, grpcDeadlineExceeded, "deadline exceeded")
+			return
+		}
+		http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+		return
+	}
+
+	b.AddFailures()
+	logging.L().Warn("backend request failed",
+		zap.String("backend_address", b.Address),
+		zap.String("path", req.URL.Path),
+		zap.Error(err),
+	)
+	if grpc {
+		b.AddGRPCStatus(grpcUnavailable)
+		writeGRPCError(w, grpcUnavailable, "backend unavailable")
+		return
+	}
+	http.Error(w, "bad gateway", http.StatusBadGateway)
+}
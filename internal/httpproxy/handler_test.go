@@ -0,0 +1,218 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedServer replies with its name and echoes the forwarding headers.
+func namedServer(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen-Forwarded-For", r.Header.Get("X-Forwarded-For"))
+		w.Header().Set("X-Seen-Forwarded", r.Header.Get("Forwarded"))
+		w.Header().Set("X-Seen-Host", r.Host)
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func poolOf(t *testing.T, servers ...*httptest.Server) *backend.Pool {
+	t.Helper()
+
+	pool := backend.NewPool()
+	for _, s := range servers {
+		if _, err := pool.AddBackend(s.Listener.Addr().String(), 1); err != nil {
+			t.Fatalf("Failed to add backend: %v", err)
+		}
+	}
+	return pool
+}
+
+func newTestHandler(t *testing.T, lb Balancer, routes ...Route) *httptest.Server {
+	t.Helper()
+
+	h, err := NewHandler(lb, Options{
+		Timeout: config.TimeoutCfg{ConnectTimeout: 1, BackendIdleSec: 30},
+		Routes:  routes,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func get(t *testing.T, req *http.Request) (*http.Response, string) {
+	t.Helper()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestHandlerRoutes(t *testing.T) {
+	def := balancer.NewRoundRobinBalancer(poolOf(t, namedServer(t, "default")))
+	api := balancer.NewRoundRobinBalancer(poolOf(t, namedServer(t, "api")))
+	static := balancer.NewRoundRobinBalancer(poolOf(t, namedServer(t, "static")))
+	canary := balancer.NewRoundRobinBalancer(poolOf(t, namedServer(t, "canary")))
+	writes := balancer.NewRoundRobinBalancer(poolOf(t, namedServer(t, "writes")))
+
+	proxy := newTestHandler(t, def,
+		Route{Headers: map[string]string{"X-Canary": "1"}, Balancer: canary},
+		Route{Host: "api.example.com", Methods: []string{"post"}, Balancer: writes},
+		Route{Host: "api.example.com", Balancer: api},
+		Route{Host: "*.cdn.example.com", PathRegex: `\.(css|js)$`, Balancer: static},
+		Route{PathPrefix: "/static/", Balancer: static},
+	)
+
+	tests := []struct {
+		method, host, path string
+		header             string
+		want               string
+	}{
+		{"GET", "api.example.com", "/users", "", "api"},
+		{"GET", "API.example.com:8080", "/users", "", "api"},
+		{"POST", "api.example.com", "/users", "", "writes"},
+		{"GET", "eu.cdn.example.com", "/app.js", "", "static"},
+		{"GET", "eu.cdn.example.com", "/index.html", "", "default"},
+		{"GET", "www.example.com", "/static/logo.png", "", "static"},
+		{"GET", "api.example.com", "/users", "1", "canary"},
+		{"GET", "www.example.com", "/", "", "default"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, proxy.URL+tt.path, nil)
+		req.Host = tt.host
+		if tt.header != "" {
+			req.Header.Set("X-Canary", tt.header)
+		}
+
+		_, body := get(t, req)
+		if body != tt.want {
+			t.Errorf("%s %s%s: expected pool %s, got %s", tt.method, tt.host, tt.path, tt.want, body)
+		}
+	}
+}
+
+func TestHandlerForwardingHeaders(t *testing.T) {
+	lb := balancer.NewRoundRobinBalancer(poolOf(t, namedServer(t, "default")))
+	proxy := newTestHandler(t, lb)
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/", nil)
+	req.Host = "www.example.com"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("Forwarded", "for=203.0.113.7")
+
+	resp, _ := get(t, req)
+
+	if got := resp.Header.Get("X-Seen-Forwarded-For"); got != "203.0.113.7, 127.0.0.1" {
+		t.Errorf("Expected X-Forwarded-For to be appended, got %q", got)
+	}
+	if got := resp.Header.Get("X-Seen-Forwarded"); got != "for=203.0.113.7, for=127.0.0.1;host=www.example.com;proto=http" {
+		t.Errorf("Unexpected Forwarded header %q", got)
+	}
+	if got := resp.Header.Get("X-Seen-Host"); got != "www.example.com" {
+		t.Errorf("Expected Host to be preserved, got %q", got)
+	}
+}
+
+func TestHandlerBalancesPerRequest(t *testing.T) {
+	a, b := namedServer(t, "a"), namedServer(t, "b")
+	proxy := newTestHandler(t, balancer.NewRoundRobinBalancer(poolOf(t, a, b)))
+
+	// One keep-alive connection, requests must still alternate
+	client := &http.Client{Transport: &http.Transport{MaxConnsPerHost: 1}}
+	seen := map[string]int{}
+	for range 4 {
+		resp, err := client.Get(proxy.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		seen[string(body)]++
+	}
+
+	if seen["a"] != 2 || seen["b"] != 2 {
+		t.Errorf("Expected requests split evenly, got %v", seen)
+	}
+}
+
+func TestHandlerBalanceKey(t *testing.T) {
+	a, b := namedServer(t, "a"), namedServer(t, "b")
+	pool := poolOf(t, a, b)
+	lb := balancer.NewStickyBalancer(balancer.NewRoundRobinBalancer(pool), pool, time.Minute, 10)
+
+	h, err := NewHandler(lb, Options{
+		Timeout: config.TimeoutCfg{ConnectTimeout: 1, BackendIdleSec: 30},
+		Key:     "cookie:session",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	proxy := httptest.NewServer(h)
+	defer proxy.Close()
+
+	// Both sessions come from the same IP but are pinned apart
+	seen := map[string]string{}
+	for range 3 {
+		for _, session := range []string{"alice", "bob"} {
+			req, _ := http.NewRequest("GET", proxy.URL, nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: session})
+			_, body := get(t, req)
+			if prev, ok := seen[session]; ok && prev != body {
+				t.Errorf("Expected session %s to stay on %s, got %s", session, prev, body)
+			}
+			seen[session] = body
+		}
+	}
+	if seen["alice"] == seen["bob"] {
+		t.Errorf("Expected sessions on different backends, got %v", seen)
+	}
+
+	if _, err := NewHandler(lb, Options{Key: "query:id"}); err == nil {
+		t.Error("Expected an error for an unknown key kind")
+	}
+}
+
+func TestHandlerBackendDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	pool := backend.NewPool()
+	b, _ := pool.AddBackend(addr, 1)
+	proxy := newTestHandler(t, balancer.NewRoundRobinBalancer(pool))
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/", nil)
+	resp, body := get(t, req)
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d (%s)", resp.StatusCode, strings.TrimSpace(body))
+	}
+	if b.Failures() != 1 {
+		t.Errorf("Expected a passive failure to be recorded, got %d", b.Failures())
+	}
+	if b.ConnCount() != 0 {
+		t.Errorf("Expected in-flight count back at 0, got %d", b.ConnCount())
+	}
+}
@@ -0,0 +1,243 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/logging"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Bodies up to this size are buffered so the request can be replayed on
+// another backend; larger ones are never retried.
+const maxRetryBody = 64 * 1024
+
+var errPerTryTimeout = errors.New("per-try timeout exceeded")
+
+// call is the per-request state shared by ServeHTTP, the rewrite and the
+// retrying transport.
+type call struct {
+	balancer Balancer
+	key      string
+	backend  *backend.Backend // serves the current try and counts it in flight
+	tried    []string
+	retry    bool // the request may be sent again
+}
+
+type callKey struct{}
+
+func callFrom(ctx context.Context) *call {
+	return ctx.Value(callKey{}).(*call)
+}
+
+type retryPolicy struct {
+	attempts       int
+	connectFailure bool
+	statuses       map[int]bool
+	nonIdempotent  bool
+	perTry         time.Duration
+	timeout        time.Duration
+
+	budgetPercent int64
+	budgetMin     int64
+	active        atomic.Int64 // requests in flight
+	retrying      atomic.Int64 // retries in flight
+}
+
+func newRetryPolicy(cfg config.RetryCfg) *retryPolicy {
+	p := &retryPolicy{
+		attempts:      cfg.Attempts,
+		statuses:      make(map[int]bool),
+		nonIdempotent: cfg.NonIdempotent,
+		perTry:        time.Duration(cfg.PerTryTimeoutMs) * time.Millisecond,
+		timeout:       time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		budgetPercent: int64(cfg.BudgetPercent),
+		budgetMin:     int64(cfg.BudgetMinRetries),
+	}
+	for _, on := range cfg.RetryOn {
+		if on == config.RetryConnectFailure {
+			p.connectFailure = true
+		} else if code, err := strconv.Atoi(on); err == nil {
+			p.statuses[code] = true
+		}
+	}
+	return p
+}
+
+// prepare reports whether req may be retried, buffering its body so it can
+// be sent again.
+func (p *retryPolicy) prepare(req *http.Request) bool {
+	if p.attempts <= 1 || !p.nonIdempotent && !idempotent(req.Method) {
+		return false
+	}
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0 {
+		return true
+	}
+	if req.ContentLength < 0 || req.ContentLength > maxRetryBody {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, req.ContentLength))
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		// Let the first try fail on the short body instead
+		return false
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return true
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryOn reports whether the outcome of a try is worth another one.
+// Per-try timeouts and dials refused by a circuit breaker are always
+// retried.
+func (p *retryPolicy) retryOn(resp *http.Response, err error) bool {
+	switch {
+	case err == nil:
+		return p.statuses[resp.StatusCode]
+	case errors.Is(err, errPerTryTimeout):
+		return true
+	case errors.Is(err, backend.ErrOverflow):
+		// Nothing was sent, another backend may have room
+		return true
+	default:
+		return p.connectFailure && isConnectError(err)
+	}
+}
+
+// acquire takes a slot from the retry budget. Retries in flight are held
+// to a share of all requests in flight so a failing pool does not
+// multiply its own load.
+func (p *retryPolicy) acquire() bool {
+	limit := max(p.budgetMin, p.active.Load()*p.budgetPercent/100)
+	if p.retrying.Add(1) > limit {
+		p.retrying.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (p *retryPolicy) release() {
+	p.retrying.Add(-1)
+}
+
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryTransport sends failed tries again to backends the request has not
+// tried yet.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy *retryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := callFrom(req.Context())
+
+	retrying := false
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		resp, err := t.try(req)
+		if err == nil {
+			// Time to first byte feeds latency aware balancing
+			c.backend.ObserveLatency(time.Since(start))
+		}
+		if retrying {
+			t.policy.release()
+		}
+		if !c.retry || attempt >= t.policy.attempts || !t.policy.retryOn(resp, err) || !t.policy.acquire() {
+			return resp, err
+		}
+		next, perr := c.balancer.Pick(c.key, c.tried...)
+		if perr != nil {
+			t.policy.release()
+			return resp, err
+		}
+		retrying = true
+
+		prev := c.backend
+		prev.AddRetry()
+		if err != nil && isConnectError(err) {
+			prev.AddFailures()
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		logging.L().Debug("retrying request",
+			zap.String("backend_address", prev.Address),
+			zap.String("next_backend_address", next.Address),
+			zap.Int("attempt", attempt+1),
+		)
+
+		// Move the in-flight count along with the request
+		prev.DecConn()
+		c.backend = next
+		c.tried = append(c.tried, next.Address)
+
+		req = req.Clone(req.Context())
+		req.URL.Host = next.Address
+		if req.GetBody != nil {
+			req.Body, _ = req.GetBody()
+		}
+	}
+}
+
+// try makes one attempt, giving up if no response headers arrive within
+// the per-try timeout.
+func (t *retryTransport) try(req *http.Request) (*http.Response, error) {
+	if t.policy.perTry <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(t.policy.perTry, func() { cancel(errPerTryTimeout) })
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	fired := !timer.Stop()
+
+	if err != nil || fired {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel(nil)
+		if context.Cause(ctx) == errPerTryTimeout {
+			return nil, errPerTryTimeout
+		}
+		return nil, err
+	}
+	// The body may take as long as it needs
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
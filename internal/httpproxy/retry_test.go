@@ -0,0 +1,173 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRetryHandler(t *testing.T, lb Balancer, retry config.RetryCfg) *httptest.Server {
+	t.Helper()
+
+	h, err := NewHandler(lb, Options{
+		Timeout: config.TimeoutCfg{ConnectTimeout: 1, BackendIdleSec: 30},
+		Retry:   retry,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func retryCfg(attempts int) config.RetryCfg {
+	return config.RetryCfg{
+		Attempts:         attempts,
+		RetryOn:          []string{config.RetryConnectFailure, "503"},
+		BudgetPercent:    20,
+		BudgetMinRetries: 3,
+	}
+}
+
+// echoServer replies with its name and the request body.
+func echoServer(t *testing.T, name string, status int) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, name+":"+string(body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func deadAddress(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestRetryStatusOnOtherBackend(t *testing.T) {
+	pool := poolOf(t, echoServer(t, "bad", http.StatusServiceUnavailable), echoServer(t, "good", http.StatusOK))
+	bad, _ := pool.GetBackend(pool.GetBackends()[0].Address)
+	proxy := newRetryHandler(t, balancer.NewRoundRobinBalancer(pool), retryCfg(2))
+
+	for range 4 {
+		req, _ := http.NewRequest("PUT", proxy.URL+"/", strings.NewReader("payload"))
+		resp, body := get(t, req)
+		if resp.StatusCode != http.StatusOK || body != "good:payload" {
+			t.Errorf("Expected the retry to replay the body on the good backend, got %d %q", resp.StatusCode, body)
+		}
+	}
+
+	// Round robin starts every request on the bad backend
+	if bad.Retries() != 4 {
+		t.Errorf("Expected 4 retries away from the bad backend, got %d", bad.Retries())
+	}
+	for _, b := range pool.GetBackends() {
+		if b.ConnCount() != 0 {
+			t.Errorf("Expected in-flight count back at 0 on %s, got %d", b.Address, b.ConnCount())
+		}
+	}
+}
+
+func TestRetryConnectFailureIdempotentOnly(t *testing.T) {
+	pool := backend.NewPool()
+	dead, _ := pool.AddBackend(deadAddress(t), 1)
+	_, _ = pool.AddBackend(echoServer(t, "good", http.StatusOK).Listener.Addr().String(), 1)
+	proxy := newRetryHandler(t, balancer.NewRoundRobinBalancer(pool), retryCfg(2))
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/", nil)
+	if resp, body := get(t, req); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected GET to be retried, got %d %q", resp.StatusCode, body)
+	}
+	if dead.Failures() != 1 || dead.Retries() != 1 {
+		t.Errorf("Expected 1 failure and 1 retry on the dead backend, got %d and %d", dead.Failures(), dead.Retries())
+	}
+
+	// Without retries one of two POSTs lands on the dead backend
+	failed := 0
+	for range 2 {
+		req, _ = http.NewRequest("POST", proxy.URL+"/", strings.NewReader("x"))
+		if resp, _ := get(t, req); resp.StatusCode == http.StatusBadGateway {
+			failed++
+		}
+	}
+	if failed != 1 || dead.Retries() != 1 {
+		t.Errorf("Expected POST not to be retried, got %d failed and %d retries", failed, dead.Retries())
+	}
+}
+
+func TestRetryPerTryTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(slow.Close)
+	pool := poolOf(t, slow, echoServer(t, "fast", http.StatusOK))
+
+	cfg := retryCfg(2)
+	cfg.PerTryTimeoutMs = 100
+	proxy := newRetryHandler(t, balancer.NewRoundRobinBalancer(pool), cfg)
+
+	start := time.Now()
+	req, _ := http.NewRequest("GET", proxy.URL+"/", nil)
+	resp, body := get(t, req)
+	if resp.StatusCode != http.StatusOK || body != "fast:" {
+		t.Errorf("Expected the slow try to be abandoned for the fast backend, got %d %q", resp.StatusCode, body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the per-try timeout to cut the slow try short, took %v", elapsed)
+	}
+	if slowBackend := pool.GetBackends()[0]; slowBackend.Failures() != 0 {
+		t.Errorf("Expected a timeout not to count as a failure, got %d", slowBackend.Failures())
+	}
+}
+
+func TestRetryOverallTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(slow.Close)
+
+	cfg := retryCfg(1)
+	cfg.TimeoutMs = 100
+	proxy := newRetryHandler(t, balancer.NewRoundRobinBalancer(poolOf(t, slow)), cfg)
+
+	req, _ := http.NewRequest("GET", proxy.URL+"/", nil)
+	if resp, _ := get(t, req); resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", resp.StatusCode)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	p := newRetryPolicy(config.RetryCfg{Attempts: 2, BudgetPercent: 50, BudgetMinRetries: 1})
+
+	p.active.Store(1)
+	if !p.acquire() || p.acquire() {
+		t.Errorf("Expected the minimum of 1 retry at low traffic")
+	}
+	p.release()
+
+	p.active.Store(4)
+	if !p.acquire() || !p.acquire() || p.acquire() {
+		t.Errorf("Expected 50%% of 4 requests in flight to allow 2 retries")
+	}
+}
@@ -0,0 +1,91 @@
+package httpproxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Route sends matching requests to Balancer. Empty fields match anything;
+// all set fields must match. Host may be a wildcard such as
+// "*.example.com", which matches one extra label.
+type Route struct {
+	Host       string
+	PathPrefix string
+	PathRegex  string
+	Methods    []string
+	Headers    map[string]string
+	Balancer   Balancer
+}
+
+type route struct {
+	Route
+	host      string
+	wildcard  bool
+	pathRegex *regexp.Regexp
+	methods   []string
+}
+
+func compileRoutes(routes []Route) ([]route, error) {
+	compiled := make([]route, 0, len(routes))
+	for _, r := range routes {
+		c := route{Route: r}
+
+		c.host = strings.ToLower(r.Host)
+		if suffix, ok := strings.CutPrefix(c.host, "*"); ok {
+			c.host, c.wildcard = suffix, true
+		}
+
+		if r.PathRegex != "" {
+			re, err := regexp.Compile(r.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path regex %q: %w", r.PathRegex, err)
+			}
+			c.pathRegex = re
+		}
+
+		for _, m := range r.Methods {
+			c.methods = append(c.methods, strings.ToUpper(m))
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+func (r *route) matches(req *http.Request) bool {
+	if r.host != "" && !r.matchHost(req.Host) {
+		return false
+	}
+	if r.PathPrefix != "" && !strings.HasPrefix(req.URL.Path, r.PathPrefix) {
+		return false
+	}
+	if r.pathRegex != nil && !r.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(r.methods) > 0 && !slices.Contains(r.methods, req.Method) {
+		return false
+	}
+	for name, value := range r.Headers {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *route) matchHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if !r.wildcard {
+		return host == r.host
+	}
+	i := strings.IndexByte(host, '.')
+	return i > 0 && host[i:] == r.host
+}
@@ -0,0 +1,123 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/logging"
+	"LoadBalancer/internal/tlsconfig"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Options struct {
+	Timeout config.TimeoutCfg
+	// Routes are tried in order, unmatched requests use the default balancer
+	Routes []Route
+	// TLS listeners offer h2 and http/1.1 through ALPN
+	TLS config.TLSCfg
+	// Accept prior-knowledge HTTP/2 over cleartext
+	H2C bool
+	// Protocol spoken to backends, http1 or h2c
+	BackendProtocol string
+	// Idle limits for upgraded WebSocket connections
+	WebSocket config.WebSocketCfg
+	// Retry policy, zero value disables retries
+	Retry config.RetryCfg
+	// Balance on "header:<name>" or "cookie:<name>" instead of the client
+	// IP, which is still used when the request lacks it
+	Key string
+}
+
+// Server is a layer-7 listener that balances every HTTP request on its own.
+type Server struct {
+	listener net.Listener
+	handler  *Handler
+	server   *http.Server
+	certs    *tlsconfig.Store // non-nil when TLS is terminated here
+	reload   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewServer(address string, balancer Balancer, options Options) (*Server, error) {
+	h, err := NewHandler(balancer, options)
+	if err != nil {
+		return nil, err
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(options.H2C)
+
+	server := &http.Server{
+		Handler:           h,
+		Protocols:         protocols,
+		ReadHeaderTimeout: time.Duration(options.Timeout.ConnectTimeout) * time.Second,
+		IdleTimeout:       time.Duration(options.Timeout.ClientIdleSec) * time.Second,
+	}
+
+	var certs *tlsconfig.Store
+	if options.TLS.Enabled {
+		server.TLSConfig, certs, err = tlsconfig.New(options.TLS)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		listener: listener,
+		handler:  h,
+		server:   server,
+		certs:    certs,
+		reload:   time.Duration(options.TLS.ReloadIntervalSec) * time.Second,
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+func (s *Server) Start() error {
+	logging.L().Info("HTTP Proxy Listening", zap.String("port", s.listener.Addr().String()))
+
+	var err error
+	if s.certs != nil {
+		go s.certs.Watch(s.ctx, s.reload)
+		// Certificates come from TLSConfig.GetCertificate
+		err = s.server.ServeTLS(s.listener, "", "")
+	} else {
+		err = s.server.Serve(s.listener)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	s.cancel()
+	err := s.server.Shutdown(ctx)
+	s.handler.transport.CloseIdleConnections()
+	// Hijacked WebSocket connections are not covered by Shutdown
+	if wsErr := s.handler.ws.shutdown(ctx); err == nil {
+		err = wsErr
+	}
+	if err != nil {
+		logging.L().Info("Context Done")
+		return err
+	}
+
+	logging.L().Info("HTTP Proxy Closed")
+	return nil
+}
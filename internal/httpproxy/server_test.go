@@ -0,0 +1,145 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/tlsconfig/tlsconfigtest"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// h2cServer starts a backend that also accepts prior-knowledge HTTP/2.
+func h2cServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewUnstartedServer(handler)
+	s.Config.Protocols = new(http.Protocols)
+	s.Config.Protocols.SetHTTP1(true)
+	s.Config.Protocols.SetUnencryptedHTTP2(true)
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func startServer(t *testing.T, lb Balancer, options Options) *Server {
+	t.Helper()
+
+	options.Timeout = config.TimeoutCfg{ConnectTimeout: 1, ClientIdleSec: 30, BackendIdleSec: 30}
+	s, err := NewServer("127.0.0.1:0", lb, options)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	go s.Start()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Stop(ctx)
+	})
+	return s
+}
+
+func h2cClient() *http.Client {
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: transport}
+}
+
+func TestServerH2CEndToEnd(t *testing.T) {
+	backend := h2cServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	})
+
+	s := startServer(t, balancer.NewRoundRobinBalancer(poolOf(t, backend)), Options{
+		H2C:             true,
+		BackendProtocol: config.BackendH2C,
+	})
+
+	resp, err := h2cClient().Get("http://" + s.listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2 from the proxy, got %s", resp.Proto)
+	}
+	if string(body) != "HTTP/2.0" {
+		t.Errorf("Expected HTTP/2 to the backend, got %s", body)
+	}
+}
+
+func TestServerTLSNegotiatesH2(t *testing.T) {
+	lb := balancer.NewRoundRobinBalancer(poolOf(t, namedServer(t, "default")))
+	s := startServer(t, lb, Options{
+		TLS: config.TLSCfg{
+			Enabled:           true,
+			Certificates:      []config.CertCfg{tlsconfigtest.WriteCert(t, t.TempDir(), "site", "www.example.com")},
+			MinVersion:        "1.2",
+			ReloadIntervalSec: 1,
+		},
+	})
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{ServerName: "www.example.com", InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + s.listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Proto != "HTTP/2.0" {
+		t.Errorf("Expected ALPN to select h2, got %s", resp.Proto)
+	}
+	if got := resp.Header.Get("X-Seen-Forwarded"); !strings.HasSuffix(got, ";proto=https") {
+		t.Errorf("Expected Forwarded proto https, got %q", got)
+	}
+}
+
+func TestServerLeastConnectionsCountsStreams(t *testing.T) {
+	release := make(chan struct{})
+	arrived := make(chan string, 2)
+	blocking := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			arrived <- name
+			<-release
+			_, _ = io.WriteString(w, name)
+		}
+	}
+	a := h2cServer(t, blocking("a"))
+	b := h2cServer(t, blocking("b"))
+
+	s := startServer(t, balancer.NewLeastConnectionsBalancer(poolOf(t, a, b)), Options{
+		H2C:             true,
+		BackendProtocol: config.BackendH2C,
+	})
+	defer close(release)
+
+	// Both streams share one client connection; the second must still go
+	// to the idle backend because the first is in flight
+	client := h2cClient()
+	url := "http://" + s.listener.Addr().String() + "/"
+	send := func() {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	go send()
+	first := <-arrived
+	go send()
+	second := <-arrived
+	if first == second {
+		t.Errorf("Expected concurrent streams on different backends, both went to %s", first)
+	}
+}
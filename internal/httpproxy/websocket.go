@@ -0,0 +1,404 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/idle"
+	"LoadBalancer/internal/logging"
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reasons reported when a WebSocket session ends
+const (
+	closeNormal   = "closed"
+	closeShutdown = "shutdown"
+)
+
+const closeGoingAway = 1001
+
+// isWebSocket reports whether req asks to upgrade to a WebSocket. Only
+// HTTP/1.1 upgrades are handled, not extended CONNECT over HTTP/2.
+func isWebSocket(req *http.Request) bool {
+	if req.ProtoMajor != 1 || !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, v := range req.Header.Values("Connection") {
+		for token := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// webSockets tracks upgraded connections, which the http.Server forgets
+// about once they are hijacked.
+type webSockets struct {
+	idle idle.Timeouts
+
+	mu       sync.Mutex
+	sessions map[*wsSession]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// add registers s. Sessions that arrive during shutdown are stopped right
+// away so they still get a close frame.
+func (ws *webSockets) add(s *wsSession) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.sessions == nil {
+		ws.sessions = make(map[*wsSession]struct{})
+	}
+	ws.sessions[s] = struct{}{}
+	ws.wg.Add(1)
+	if ws.closed {
+		s.stop()
+	}
+}
+
+func (ws *webSockets) remove(s *wsSession) {
+	ws.mu.Lock()
+	delete(ws.sessions, s)
+	ws.mu.Unlock()
+	ws.wg.Done()
+}
+
+// shutdown sends every session a close frame and waits for them to end.
+func (ws *webSockets) shutdown(ctx context.Context) error {
+	ws.mu.Lock()
+	ws.closed = true
+	for s := range ws.sessions {
+		s.stop()
+	}
+	ws.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *Handler) serveWebSocket(w http.ResponseWriter, req *http.Request, b *backend.Backend) {
+	out := req.Clone(req.Context())
+	h.rewrite(&httputil.ProxyRequest{In: req, Out: out})
+	out.Header.Set("Connection", "Upgrade")
+
+	conn, err := h.dial(req.Context(), "tcp", b.Address)
+	if err != nil {
+		h.proxyError(w, req, err)
+		return
+	}
+
+	// The handshake must not hang on a silent backend
+	if h.ws.idle.Backend > 0 {
+		_ = conn.SetDeadline(time.Now().Add(h.ws.idle.Backend))
+	}
+	br := bufio.NewReader(conn)
+	if err := out.Write(conn); err != nil {
+		conn.Close()
+		h.proxyError(w, req, err)
+		return
+	}
+	resp, err := http.ReadResponse(br, out)
+	if err != nil {
+		conn.Close()
+		h.proxyError(w, req, err)
+		return
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		// Backend refused the upgrade, pass its answer on as is
+		defer conn.Close()
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	client, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		conn.Close()
+		logging.L().Error("failed to hijack websocket connection", zap.String("client_address", req.RemoteAddr), zap.Error(err))
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = resp.Header.Write(brw)
+	_, _ = brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		client.Close()
+		conn.Close()
+		return
+	}
+
+	// Either side may have sent frames right behind the handshake
+	s := &wsSession{
+		client:  &bufferedConn{Conn: client, r: brw.Reader},
+		backend: &bufferedConn{Conn: conn, r: br},
+	}
+	h.ws.add(s)
+	defer h.ws.remove(s)
+
+	sent, received := s.run(h.ws.idle)
+	b.AddTraffic(sent, received)
+
+	fields := []zap.Field{
+		zap.String("client_address", req.RemoteAddr),
+		zap.String("backend_address", b.Address),
+		zap.String("path", req.URL.Path),
+		zap.String("reason", s.reason),
+		zap.Int64("bytes_sent", sent),
+		zap.Int64("bytes_received", received),
+	}
+	switch s.reason {
+	case idle.ClientIdle, idle.BackendIdle:
+		logging.L().Info("websocket idle timeout", fields...)
+	default:
+		logging.L().Debug("websocket closed", fields...)
+	}
+}
+
+// bufferedConn reads through r first, which may hold bytes read past the
+// end of the handshake.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// wsSession relays an upgraded connection byte for byte, only following
+// frame boundaries so it knows when a close frame can be slipped in.
+type wsSession struct {
+	client  net.Conn
+	backend net.Conn
+
+	// Each is only touched by the relay writing in that direction
+	toClient  frameTracker
+	toBackend frameTracker
+
+	activity *idle.Tracker
+
+	stopping atomic.Bool
+	once     sync.Once
+	reason   string
+}
+
+// run relays until either side closes or idles out, or stop is called.
+func (s *wsSession) run(limits idle.Timeouts) (sent, received int64) {
+	s.activity = idle.NewTracker(limits, time.Now())
+
+	done := make(chan struct{})
+	if limits.Enabled() {
+		go s.watchIdle(limits, done)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent = s.relay(s.backend, s.client, &s.toBackend, s.activity.Up)
+	}()
+	go func() {
+		defer wg.Done()
+		received = s.relay(s.client, s.backend, &s.toClient, s.activity.Down)
+	}()
+	wg.Wait()
+	close(done)
+
+	if s.stopping.Load() {
+		s.goAway()
+		s.finish(closeShutdown)
+	}
+	return sent, received
+}
+
+func (s *wsSession) relay(dst, src net.Conn, frames *frameTracker, active func(time.Time)) int64 {
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		// Checked before every read so a concurrent stop is never lost, its
+		// deadline unblocks a read that is already waiting
+		if s.stopping.Load() {
+			return written
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			active(time.Now())
+			m, werr := dst.Write(buf[:n])
+			frames.feed(buf[:m])
+			written += int64(m)
+			if werr != nil && !s.stopping.Load() {
+				s.finish(closeNormal)
+				return written
+			}
+		}
+		if err != nil {
+			if !s.stopping.Load() {
+				s.finish(closeNormal)
+			}
+			return written
+		}
+	}
+}
+
+// watchIdle ends the session once the side being waited on has been idle
+// for its limit.
+func (s *wsSession) watchIdle(limits idle.Timeouts, done <-chan struct{}) {
+	_, wait := s.activity.Check(time.Now())
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-timer.C:
+			// Shutting down already, run sends the close frames
+			if s.stopping.Load() {
+				return
+			}
+			reason, wait := s.activity.Check(now)
+			if reason != "" {
+				s.finish(reason)
+				return
+			}
+			timer.Reset(wait)
+		}
+	}
+}
+
+// finish records why the session ended and closes both sides, which also
+// unblocks the other direction.
+func (s *wsSession) finish(reason string) {
+	s.once.Do(func() {
+		s.reason = reason
+		s.client.Close()
+		s.backend.Close()
+	})
+}
+
+// stop interrupts both relays but leaves the connections open for goAway.
+func (s *wsSession) stop() {
+	s.stopping.Store(true)
+	now := time.Now()
+	_ = s.client.SetDeadline(now)
+	_ = s.backend.SetDeadline(now)
+}
+
+// goAway sends a Going Away close frame to each side that is not in the
+// middle of a frame. Frames towards the backend are masked, as the proxy
+// is its client.
+func (s *wsSession) goAway() {
+	deadline := time.Now().Add(time.Second)
+	if s.toClient.atBoundary() {
+		_ = s.client.SetWriteDeadline(deadline)
+		_, _ = s.client.Write(closeFrame(false))
+	}
+	if s.toBackend.atBoundary() {
+		_ = s.backend.SetWriteDeadline(deadline)
+		_, _ = s.backend.Write(closeFrame(true))
+	}
+}
+
+func closeFrame(masked bool) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, closeGoingAway)
+	payload = append(payload, "proxy shutting down"...)
+
+	frame := []byte{0x88, byte(len(payload))} // FIN + close
+	if masked {
+		key := binary.BigEndian.AppendUint32(nil, rand.Uint32())
+		frame[1] |= 0x80
+		frame = append(frame, key...)
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return append(frame, payload...)
+}
+
+// frameTracker follows WebSocket frame headers in a byte stream.
+type frameTracker struct {
+	header    []byte // header bytes of the next frame seen so far
+	remaining uint64 // payload bytes left in the current frame
+}
+
+func (f *frameTracker) feed(p []byte) {
+	for len(p) > 0 {
+		if f.remaining > 0 {
+			n := min(uint64(len(p)), f.remaining)
+			f.remaining -= n
+			p = p[n:]
+			continue
+		}
+		f.header = append(f.header, p[0])
+		p = p[1:]
+		if length, ok := payloadLength(f.header); ok {
+			f.remaining = length
+			f.header = f.header[:0]
+		}
+	}
+}
+
+func (f *frameTracker) atBoundary() bool {
+	return f.remaining == 0 && len(f.header) == 0
+}
+
+// payloadLength returns the payload length once header holds a complete
+// frame header.
+func payloadLength(header []byte) (uint64, bool) {
+	if len(header) < 2 {
+		return 0, false
+	}
+	size, extended := 2, 0
+	switch header[1] & 0x7f {
+	case 126:
+		extended = 2
+	case 127:
+		extended = 8
+	}
+	size += extended
+	if header[1]&0x80 != 0 {
+		size += 4 // masking key
+	}
+	if len(header) < size {
+		return 0, false
+	}
+
+	switch extended {
+	case 2:
+		return uint64(binary.BigEndian.Uint16(header[2:4])), true
+	case 8:
+		return binary.BigEndian.Uint64(header[2:10]), true
+	default:
+		return uint64(header[1] & 0x7f), true
+	}
+}
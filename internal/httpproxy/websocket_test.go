@@ -0,0 +1,175 @@
+package httpproxy
+
+import (
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/idle"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFrameTracker(t *testing.T) {
+	masked := []byte{0x81, 0x82, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2}
+	long := append([]byte{0x82, 126, 0x01, 0x00}, make([]byte, 256)...)
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+		want   bool
+	}{
+		{"masked frame", [][]byte{masked}, true},
+		{"split header", [][]byte{masked[:1], masked[1:3], masked[3:]}, true},
+		{"partial payload", [][]byte{masked[:7]}, false},
+		{"partial header", [][]byte{long[:3]}, false},
+		{"extended length", [][]byte{long[:100], long[100:]}, true},
+		{"two frames", [][]byte{append(append([]byte{}, masked...), long[:10]...)}, false},
+	}
+
+	for _, tt := range tests {
+		var f frameTracker
+		for _, c := range tt.chunks {
+			f.feed(c)
+		}
+		if f.atBoundary() != tt.want {
+			t.Errorf("%s: expected boundary %v, got %v", tt.name, tt.want, f.atBoundary())
+		}
+	}
+}
+
+func TestWebSocketSession(t *testing.T) {
+	received := make(chan []byte, 16)
+	// Completes any upgrade, then echoes raw bytes and reports them
+	backend := h2cServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !isWebSocket(r) {
+			http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		_ = brw.Flush()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := brw.Read(buf)
+			if err != nil {
+				return
+			}
+			received <- append([]byte(nil), buf[:n]...)
+			_, _ = conn.Write(buf[:n])
+		}
+	})
+	pool := poolOf(t, backend)
+	b := pool.GetBackends()[0]
+	s := startServer(t, balancer.NewRoundRobinBalancer(pool), Options{})
+
+	client, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, _ = io.WriteString(client, "GET /chat HTTP/1.1\r\nHost: chat.example.com\r\n"+
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(client)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+
+	frame := []byte{0x81, 0x82, 1, 2, 3, 4, 'h' ^ 1, 'i' ^ 2}
+	_, _ = client.Write(frame)
+	echo := make([]byte, len(frame))
+	if _, err := io.ReadFull(br, echo); err != nil {
+		t.Fatalf("Failed to read echo: %v", err)
+	}
+	if !bytes.Equal(echo, frame) {
+		t.Errorf("Expected echo %v, got %v", frame, echo)
+	}
+	<-received
+
+	if b.ConnCount() != 1 {
+		t.Errorf("Expected the open session to be counted, got %d", b.ConnCount())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	// The client gets an unmasked Going Away close frame
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		t.Fatalf("Failed to read close frame: %v", err)
+	}
+	if header[0] != 0x88 || header[1]&0x80 != 0 || binary.BigEndian.Uint16(header[2:]) != closeGoingAway {
+		t.Errorf("Expected an unmasked close frame with code 1001, got %v", header)
+	}
+
+	// The backend gets a masked one
+	if got := <-received; len(got) < 2 || got[0] != 0x88 || got[1]&0x80 == 0 {
+		t.Errorf("Expected a masked close frame at the backend, got %v", got)
+	}
+	if b.ConnCount() != 0 {
+		t.Errorf("Expected the session to be released, got %d", b.ConnCount())
+	}
+}
+
+func TestWebSocketOneWayStream(t *testing.T) {
+	clientApp, proxyClientSide := net.Pipe()
+	defer clientApp.Close()
+	proxyBackendSide, backendApp := net.Pipe()
+	defer backendApp.Close()
+
+	s := &wsSession{client: proxyClientSide, backend: proxyBackendSide}
+	done := make(chan int64, 1)
+	go func() {
+		_, received := s.run(idle.Timeouts{Client: 100 * time.Millisecond, Backend: time.Minute})
+		done <- received
+	}()
+
+	// Only the backend talks, for several client idle limits
+	go func() {
+		for range 10 {
+			if _, err := backendApp.Write([]byte{0x81, 0x02, 'h', 'i'}); err != nil {
+				return
+			}
+			time.Sleep(40 * time.Millisecond)
+		}
+	}()
+
+	buf := make([]byte, 4)
+	for i := range 10 {
+		if _, err := io.ReadFull(clientApp, buf); err != nil {
+			t.Fatalf("Session ended after %d frames: %v", i, err)
+		}
+	}
+
+	// Once the backend goes quiet too, the client is the one being waited on
+	select {
+	case received := <-done:
+		if s.reason != idle.ClientIdle {
+			t.Errorf("Expected reason %s, got %s", idle.ClientIdle, s.reason)
+		}
+		if received != 40 {
+			t.Errorf("Expected 40 bytes received, got %d", received)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Quiet session was not closed")
+	}
+}
@@ -0,0 +1,86 @@
+package idle
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Reasons reported when a connection is closed for idling
+const (
+	ClientIdle  = "client_idle"
+	BackendIdle = "backend_idle"
+)
+
+// Timeouts bounds how long either side may stay silent. Zero disables the
+// limit for that side.
+type Timeouts struct {
+	Client  time.Duration
+	Backend time.Duration
+}
+
+// Enabled reports whether either side has a limit.
+func (t Timeouts) Enabled() bool {
+	return t.Client > 0 || t.Backend > 0
+}
+
+// Shortest is the smaller of the enabled limits.
+func (t Timeouts) Shortest() time.Duration {
+	switch {
+	case t.Client <= 0:
+		return t.Backend
+	case t.Backend <= 0:
+		return t.Client
+	default:
+		return min(t.Client, t.Backend)
+	}
+}
+
+// Tracker remembers when each direction last carried data.
+type Tracker struct {
+	limits   Timeouts
+	lastUp   atomic.Int64 // client -> backend, unix nanos
+	lastDown atomic.Int64 // backend -> client, unix nanos
+}
+
+func NewTracker(limits Timeouts, now time.Time) *Tracker {
+	t := &Tracker{limits: limits}
+	t.lastUp.Store(now.UnixNano())
+	t.lastDown.Store(now.UnixNano())
+	return t
+}
+
+// Up records data from the client to the backend.
+func (t *Tracker) Up(now time.Time) {
+	t.lastUp.Store(now.UnixNano())
+}
+
+// Down records data from the backend to the client.
+func (t *Tracker) Down(now time.Time) {
+	t.lastDown.Store(now.UnixNano())
+}
+
+// Check reports which side has gone idle, if any, and otherwise how long to
+// wait before checking again. Whoever spoke last is waiting on the other
+// side, so a client request with no reply is a backend timeout and a reply
+// with no follow-up is a client timeout.
+func (t *Tracker) Check(now time.Time) (string, time.Duration) {
+	up, down := t.lastUp.Load(), t.lastDown.Load()
+
+	reason, limit, last := BackendIdle, t.limits.Backend, up
+	if down >= up {
+		reason, limit, last = ClientIdle, t.limits.Client, down
+	}
+
+	// The side being waited on can change before the next check, so never
+	// sleep past the shortest limit
+	wait := t.limits.Shortest()
+	if limit <= 0 {
+		return "", wait
+	}
+
+	idle := now.Sub(time.Unix(0, last))
+	if idle >= limit {
+		return reason, 0
+	}
+	return "", min(limit-idle, wait)
+}
@@ -0,0 +1,47 @@
+package idle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackerCheck(t *testing.T) {
+	start := time.Now()
+	limits := Timeouts{Client: 10 * time.Second, Backend: 4 * time.Second}
+
+	tests := []struct {
+		name       string
+		up, down   time.Duration // since start, < 0 leaves the direction silent
+		at         time.Duration
+		wantReason string
+		wantWait   time.Duration
+	}{
+		{"fresh", -1, -1, time.Second, "", 4 * time.Second},
+		{"client silent", -1, -1, 10 * time.Second, ClientIdle, 0},
+		{"waiting on the backend", 2 * time.Second, -1, 5 * time.Second, "", time.Second},
+		{"backend silent", 2 * time.Second, -1, 6 * time.Second, BackendIdle, 0},
+		{"answered", 2 * time.Second, 3 * time.Second, 9 * time.Second, "", 4 * time.Second},
+		{"client silent after an answer", 2 * time.Second, 3 * time.Second, 13 * time.Second, ClientIdle, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker(limits, start)
+			if tt.up >= 0 {
+				tr.Up(start.Add(tt.up))
+			}
+			if tt.down >= 0 {
+				tr.Down(start.Add(tt.down))
+			}
+			reason, wait := tr.Check(start.Add(tt.at))
+			if reason != tt.wantReason || wait != tt.wantWait {
+				t.Errorf("Expected %q after %s, got %q after %s", tt.wantReason, tt.wantWait, reason, wait)
+			}
+		})
+	}
+
+	// Without limits nothing ever idles out
+	tr := NewTracker(Timeouts{}, start)
+	if reason, _ := tr.Check(start.Add(time.Hour)); reason != "" {
+		t.Errorf("Expected no timeout without limits, got %q", reason)
+	}
+}
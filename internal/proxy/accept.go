@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/proxyproto"
+	"fmt"
+	"net"
+	"time"
+)
+
+// proxyAcceptor unwraps PROXY headers sent by trusted upstream balancers.
+// Connections from other sources are passed through untouched.
+type proxyAcceptor struct {
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+func newProxyAcceptor(cfg config.AcceptProxyCfg) (*proxyAcceptor, error) {
+	a := &proxyAcceptor{
+		timeout: time.Duration(cfg.TimeoutSec) * time.Second,
+	}
+
+	for _, cidr := range cfg.TrustedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted CIDR %q: %w", cidr, err)
+		}
+		a.trusted = append(a.trusted, network)
+	}
+	return a, nil
+}
+
+func (a *proxyAcceptor) trusts(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, network := range a.trusted {
+		if network.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap reads the PROXY header from a trusted peer. Trusted peers must send
+// one; a missing or malformed header fails the connection.
+func (a *proxyAcceptor) wrap(conn net.Conn) (net.Conn, error) {
+	if !a.trusts(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(a.timeout))
+	header, err := proxyproto.ReadHeader(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	return proxyproto.NewConn(conn, header), nil
+}
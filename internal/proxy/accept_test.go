@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/proxyproto"
+	"net"
+	"testing"
+)
+
+func TestProxyAcceptorTrustedPeer(t *testing.T) {
+	a, err := newProxyAcceptor(config.AcceptProxyCfg{
+		Enabled:      true,
+		TrustedCIDRs: []string{"127.0.0.0/8"},
+		TimeoutSec:   1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create acceptor: %v", err)
+	}
+
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	realClient := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 40000}
+	if err := proxyproto.WriteHeader(client, proxyproto.V2, realClient, server.LocalAddr()); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	conn, err := a.wrap(server)
+	if err != nil {
+		t.Fatalf("wrap failed: %v", err)
+	}
+	if conn.RemoteAddr().String() != realClient.String() {
+		t.Errorf("Expected remote address %s, got %s", realClient, conn.RemoteAddr())
+	}
+
+	// Zero-copy paths still reach the socket
+	if _, ok := conn.(interface{ CloseWrite() error }); !ok {
+		t.Error("Wrapped conn should support CloseWrite")
+	}
+}
+
+func TestProxyAcceptorUntrustedPeer(t *testing.T) {
+	a, err := newProxyAcceptor(config.AcceptProxyCfg{
+		Enabled:      true,
+		TrustedCIDRs: []string{"10.0.0.0/8"},
+		TimeoutSec:   1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create acceptor: %v", err)
+	}
+
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	// A header from an untrusted peer is not interpreted
+	conn, err := a.wrap(server)
+	if err != nil {
+		t.Fatalf("wrap failed: %v", err)
+	}
+	if conn != server {
+		t.Error("Untrusted connection should be passed through untouched")
+	}
+}
+
+func TestProxyAcceptorMissingHeader(t *testing.T) {
+	a, err := newProxyAcceptor(config.AcceptProxyCfg{
+		Enabled:      true,
+		TrustedCIDRs: []string{"127.0.0.0/8"},
+		TimeoutSec:   1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create acceptor: %v", err)
+	}
+
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := client.Write([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := a.wrap(server); err == nil {
+		t.Error("Expected error for trusted peer without header")
+	}
+}
@@ -1,35 +1,133 @@
 package proxy
 
 import (
+	"LoadBalancer/internal/idle"
 	"context"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func pipe(ctx context.Context, a, b net.Conn) {
+// Reasons reported when a proxied connection ends
+const (
+	closeNormal   = "closed"
+	closeShutdown = "shutdown"
+)
+
+const streamBufSize = 32 * 1024
+
+var streamBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, streamBufSize)
+		return &b
+	},
+}
+
+// forwarder moves bytes in one direction of a proxied connection. The
+// default copies through user space; platform specific data paths plug in
+// here. onData is called with every chunk that is read from src.
+type forwarder interface {
+	forward(dst, src net.Conn, onData func(n int64)) (int64, error)
+	// interrupt unblocks any copy currently reading from or writing to conn
+	interrupt(conn net.Conn)
+}
+
+type streamForwarder struct{}
+
+func (streamForwarder) forward(dst, src net.Conn, onData func(n int64)) (int64, error) {
+	bp := streamBufPool.Get().(*[]byte)
+	defer streamBufPool.Put(bp)
+	buf := *bp
+
+	var written int64
+	for {
+		n, rerr := src.Read(buf)
+		if n > 0 {
+			onData(int64(n))
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+func (streamForwarder) interrupt(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now())
+}
+
+// pipeResult describes a finished pipe.
+type pipeResult struct {
+	sent     int64 // a -> b
+	received int64 // b -> a
+	reason   string
+	// Error that ended reading from b, such as a reset
+	backendErr error
+}
+
+// pipe shuttles bytes between a (client) and b (backend) until both
+// directions finish, either side idles out or ctx is cancelled.
+func pipe(ctx context.Context, a, b net.Conn, fwd forwarder, limits idle.Timeouts) pipeResult {
 	var wg sync.WaitGroup
 	wg.Add(2)
 
+	var res pipeResult
+	var reason atomic.Value
+	reason.Store(closeNormal)
+
+	act := idle.NewTracker(limits, time.Now())
+
 	// Channel to signal that legitimate copying is done
 	done := make(chan struct{})
 
 	go func() {
-		select {
-		case <-ctx.Done():
-			// Shutdown signal received, force close connections
-			_ = a.SetDeadline(time.Now())
-			_ = b.SetDeadline(time.Now())
-		case <-done:
-			// Normal completion, exit to avoid leak
-			return
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if limits.Enabled() {
+			_, wait := act.Check(time.Now())
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				// Shutdown signal received, force close connections
+				reason.Store(closeShutdown)
+				fwd.interrupt(a)
+				fwd.interrupt(b)
+				return
+			case <-done:
+				// Normal completion, exit to avoid leak
+				return
+			case now := <-timeout:
+				r, wait := act.Check(now)
+				if r == "" {
+					timer.Reset(wait)
+					continue
+				}
+				reason.Store(r)
+				fwd.interrupt(a)
+				fwd.interrupt(b)
+				return
+			}
 		}
 	}()
 
 	go func() {
 		defer wg.Done()
-		_, err := io.Copy(b, a)
+		var err error
+		res.sent, err = fwd.forward(b, a, func(int64) { act.Up(time.Now()) })
 		if err != nil {
 			b.Close()
 		}
@@ -38,7 +136,9 @@ func pipe(ctx context.Context, a, b net.Conn) {
 
 	go func() {
 		defer wg.Done()
-		_, err := io.Copy(a, b)
+		var err error
+		res.received, err = fwd.forward(a, b, func(int64) { act.Down(time.Now()) })
+		res.backendErr = err
 		if err != nil {
 			a.Close()
 		}
@@ -47,10 +147,12 @@ func pipe(ctx context.Context, a, b net.Conn) {
 
 	wg.Wait()
 	close(done)
+	res.reason = reason.Load().(string)
+	return res
 }
 
 func closeWrite(conn net.Conn) {
-	if tcp, ok := conn.(*net.TCPConn); ok {
-		_ = tcp.CloseWrite()
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
 	}
 }
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/idle"
+	"context"
+	"io"
+	"net"
+	"testing"
+)
+
+const benchmarkChunk = 64 * 1024
+
+// tcpPair returns both ends of a loopback TCP connection.
+func tcpPair(tb testing.TB) (net.Conn, net.Conn) {
+	tb.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		accepted <- c
+	}()
+
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatalf("Failed to dial: %v", err)
+	}
+
+	server := <-accepted
+	if server == nil {
+		tb.Fatal("Failed to accept connection")
+	}
+	return dialed, server
+}
+
+// benchmarkPipe pushes data client -> proxy -> backend through pipe using fwd.
+func benchmarkPipe(b *testing.B, fwd forwarder) {
+	client, proxyClientSide := tcpPair(b)
+	proxyBackendSide, server := tcpPair(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var sent int64
+	piped := make(chan struct{})
+	go func() {
+		sent = pipe(ctx, proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{}).sent
+		close(piped)
+	}()
+
+	chunk := make([]byte, benchmarkChunk)
+	sink := make([]byte, benchmarkChunk)
+
+	b.SetBytes(benchmarkChunk)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := client.Write(chunk); err != nil {
+			b.Fatalf("Write failed: %v", err)
+		}
+		if _, err := io.ReadFull(server, sink); err != nil {
+			b.Fatalf("Read failed: %v", err)
+		}
+	}
+	b.StopTimer()
+
+	client.Close()
+	server.Close()
+	<-piped
+	proxyClientSide.Close()
+	proxyBackendSide.Close()
+
+	if want := int64(b.N) * benchmarkChunk; sent != want {
+		b.Errorf("Expected %d bytes forwarded, got %d", want, sent)
+	}
+}
+
+func BenchmarkPipe_Stream(b *testing.B) {
+	benchmarkPipe(b, streamForwarder{})
+}
@@ -0,0 +1,279 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/idle"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPipeClientIdle(t *testing.T) {
+	for name, fwd := range testForwarders(t) {
+		t.Run(name, func(t *testing.T) {
+			client, proxyClientSide := tcpPair(t)
+			defer client.Close()
+			proxyBackendSide, server := tcpPair(t)
+			defer server.Close()
+
+			// Client never sends anything
+			start := time.Now()
+			res := pipe(context.Background(), proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{
+				Client:  100 * time.Millisecond,
+				Backend: time.Minute,
+			})
+
+			if res.reason != idle.ClientIdle {
+				t.Errorf("Expected reason %s, got %s", idle.ClientIdle, res.reason)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Idle timeout took too long: %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestPipeBackendIdle(t *testing.T) {
+	for name, fwd := range testForwarders(t) {
+		t.Run(name, func(t *testing.T) {
+			client, proxyClientSide := tcpPair(t)
+			defer client.Close()
+			proxyBackendSide, server := tcpPair(t)
+			defer server.Close()
+
+			// Client sends a request the backend never answers
+			if _, err := client.Write([]byte("ping")); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			res := pipe(context.Background(), proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{
+				Client:  time.Minute,
+				Backend: 100 * time.Millisecond,
+			})
+
+			if res.reason != idle.BackendIdle {
+				t.Errorf("Expected reason %s, got %s", idle.BackendIdle, res.reason)
+			}
+			if res.sent != 4 {
+				t.Errorf("Expected 4 bytes sent, got %d", res.sent)
+			}
+		})
+	}
+}
+
+func TestPipeStalledWrite(t *testing.T) {
+	for name, fwd := range testForwarders(t) {
+		t.Run(name, func(t *testing.T) {
+			client, proxyClientSide := tcpPair(t)
+			defer client.Close()
+			proxyBackendSide, server := tcpPair(t)
+			defer server.Close()
+
+			// Backend streams to a client that never reads, so once the
+			// socket buffers fill up the copy is stuck writing
+			go func() {
+				chunk := make([]byte, benchmarkChunk)
+				for {
+					if _, err := server.Write(chunk); err != nil {
+						return
+					}
+				}
+			}()
+
+			done := make(chan pipeResult, 1)
+			go func() {
+				done <- pipe(context.Background(), proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{
+					Client:  200 * time.Millisecond,
+					Backend: time.Minute,
+				})
+			}()
+
+			select {
+			case res := <-done:
+				if res.reason != idle.ClientIdle {
+					t.Errorf("Expected reason %s, got %s", idle.ClientIdle, res.reason)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Idle timeout did not interrupt the blocked write")
+			}
+		})
+	}
+}
+
+func TestPipeByteCounts(t *testing.T) {
+	for name, fwd := range testForwarders(t) {
+		t.Run(name, func(t *testing.T) {
+			client, proxyClientSide := tcpPair(t)
+			defer client.Close()
+			proxyBackendSide, server := tcpPair(t)
+			defer server.Close()
+
+			done := make(chan pipeResult, 1)
+			go func() {
+				done <- pipe(context.Background(), proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{})
+			}()
+
+			// Both directions stream at once, more than a splice pipe or a
+			// ring buffer holds
+			request := make([]byte, 3<<20+17)
+			response := make([]byte, 2<<20+5)
+			_, _ = rand.Read(request)
+			_, _ = rand.Read(response)
+
+			go func() {
+				_, _ = client.Write(request)
+				_ = client.(*net.TCPConn).CloseWrite()
+			}()
+			go func() {
+				_, _ = server.Write(response)
+				_ = server.(*net.TCPConn).CloseWrite()
+			}()
+
+			gotRequest, err := io.ReadAll(server)
+			if err != nil {
+				t.Fatalf("Backend read failed: %v", err)
+			}
+			gotResponse, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("Client read failed: %v", err)
+			}
+			if !bytes.Equal(gotRequest, request) {
+				t.Errorf("Expected %d request bytes intact, got %d", len(request), len(gotRequest))
+			}
+			if !bytes.Equal(gotResponse, response) {
+				t.Errorf("Expected %d response bytes intact, got %d", len(response), len(gotResponse))
+			}
+
+			res := <-done
+			if res.sent != int64(len(request)) {
+				t.Errorf("Expected %d bytes sent, got %d", len(request), res.sent)
+			}
+			if res.received != int64(len(response)) {
+				t.Errorf("Expected %d bytes received, got %d", len(response), res.received)
+			}
+			if res.reason != closeNormal {
+				t.Errorf("Expected reason %s, got %s", closeNormal, res.reason)
+			}
+		})
+	}
+}
+
+func TestPipeHalfClose(t *testing.T) {
+	for name, fwd := range testForwarders(t) {
+		t.Run(name, func(t *testing.T) {
+			client, proxyClientSide := tcpPair(t)
+			defer client.Close()
+			proxyBackendSide, server := tcpPair(t)
+			defer server.Close()
+
+			done := make(chan pipeResult, 1)
+			go func() {
+				done <- pipe(context.Background(), proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{
+					Client:  5 * time.Second,
+					Backend: 5 * time.Second,
+				})
+			}()
+
+			// The client finishes sending, the backend must see EOF and can
+			// still answer over the other direction
+			if _, err := client.Write([]byte("hello")); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+				t.Fatalf("CloseWrite failed: %v", err)
+			}
+
+			_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+			request, err := io.ReadAll(server)
+			if err != nil {
+				t.Fatalf("Backend did not see the client's half-close: %v", err)
+			}
+			if _, err := server.Write(append([]byte("got "), request...)); err != nil {
+				t.Fatalf("Write after half-close failed: %v", err)
+			}
+			_ = server.(*net.TCPConn).CloseWrite()
+
+			_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+			reply, err := io.ReadAll(client)
+			if err != nil {
+				t.Fatalf("Client did not see the backend's half-close: %v", err)
+			}
+			if string(reply) != "got hello" {
+				t.Errorf("Expected %q, got %q", "got hello", reply)
+			}
+
+			res := <-done
+			if res.sent != 5 || res.received != 9 {
+				t.Errorf("Expected 5 bytes sent and 9 received, got %d and %d", res.sent, res.received)
+			}
+			if res.reason != closeNormal {
+				t.Errorf("Expected reason %s, got %s", closeNormal, res.reason)
+			}
+		})
+	}
+}
+
+func TestPipeActivityKeepsAlive(t *testing.T) {
+	for name, fwd := range testForwarders(t) {
+		t.Run(name, func(t *testing.T) {
+			client, proxyClientSide := tcpPair(t)
+			proxyBackendSide, server := tcpPair(t)
+
+			done := make(chan pipeResult, 1)
+			go func() {
+				done <- pipe(context.Background(), proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{
+					Client:  150 * time.Millisecond,
+					Backend: 150 * time.Millisecond,
+				})
+			}()
+
+			// Keep talking for longer than the idle limit
+			buf := make([]byte, 4)
+			for i := 0; i < 5; i++ {
+				time.Sleep(50 * time.Millisecond)
+				if _, err := client.Write([]byte("ping")); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+				if _, err := io.ReadFull(server, buf); err != nil {
+					t.Fatalf("Read failed: %v", err)
+				}
+				if _, err := server.Write([]byte("pong")); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+				if _, err := io.ReadFull(client, buf); err != nil {
+					t.Fatalf("Read failed: %v", err)
+				}
+			}
+
+			client.Close()
+			server.Close()
+
+			res := <-done
+			if res.reason != closeNormal {
+				t.Errorf("Expected reason %s, got %s", closeNormal, res.reason)
+			}
+		})
+	}
+}
+
+func TestPipeShutdown(t *testing.T) {
+	for name, fwd := range testForwarders(t) {
+		t.Run(name, func(t *testing.T) {
+			client, proxyClientSide := tcpPair(t)
+			defer client.Close()
+			proxyBackendSide, server := tcpPair(t)
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			res := pipe(ctx, proxyClientSide, proxyBackendSide, fwd, idle.Timeouts{})
+			if res.reason != closeShutdown {
+				t.Errorf("Expected reason %s, got %s", closeShutdown, res.reason)
+			}
+		})
+	}
+}
@@ -3,48 +3,219 @@ package proxy
 import (
 	"LoadBalancer/internal/backend"
 	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/idle"
 	"LoadBalancer/internal/logging"
+	"LoadBalancer/internal/proxyproto"
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 )
 
 type Balancer interface {
-	Pick(key string) (*backend.Backend, error)
+	Pick(key string, exclude ...string) (*backend.Backend, error)
+}
+
+// Observer is told how connections to backends go, for passive outlier
+// detection.
+type Observer interface {
+	ConnectFailed(b *backend.Backend)
+	Connected(b *backend.Backend, rtt time.Duration)
+	// Closed is called when a connection ends, with whether the backend
+	// reset it
+	Closed(b *backend.Backend, lifetime time.Duration, reset bool)
 }
 
 type Handler struct {
 	Balancer Balancer
 	Timeouts config.TimeoutCfg
+	// Extra backends to try when dialing the picked one fails
+	ConnectRetries int
+	// Consecutive failures, failed dials and health checks alike, that mark
+	// a backend dead. 0 never does, for when no health checker would bring
+	// it back
+	FailureThreshold int
+	// PROXY protocol version used when the backend has no setting of its own
+	SendProxy string
+	// Optional, told about every connect and connection to a backend
+	Observer Observer
+
+	forwarder forwarder
+	routes    *sniRouter // non-nil when connections are routed by SNI
 }
 
 func NewHandler(balancer Balancer, timeouts config.TimeoutCfg) *Handler {
 	return &Handler{
-		Balancer: balancer,
-		Timeouts: timeouts,
+		Balancer:  balancer,
+		Timeouts:  timeouts,
+		forwarder: defaultForwarder(),
+	}
+}
+
+// connect dials a backend picked by lb for key. When a dial fails the backend is
+// charged a passive failure and another one, not yet tried for this
+// connection, is picked, up to ConnectRetries times. Backends whose circuit
+// breaker refuses the dial are passed over without using up a retry.
+func (h *Handler) connect(lb Balancer, key string) (*backend.Backend, net.Conn, error) {
+	timeout := time.Duration(h.Timeouts.ConnectTimeout) * time.Second
+	tried := make([]string, 0, h.ConnectRetries+1)
+
+	var lastErr error
+	for attempt := 0; attempt <= h.ConnectRetries; {
+		b, err := lb.Pick(key, tried...)
+		if err != nil {
+			if lastErr != nil {
+				return nil, nil, fmt.Errorf("%w (last dial error: %v)", err, lastErr)
+			}
+			return nil, nil, err
+		}
+		tried = append(tried, b.Address)
+
+		if err := b.BeginConnect(); err != nil {
+			// Other dials took the backend's last slot since the pick, which
+			// is no failure of the backend
+			b.DecConn()
+			lastErr = err
+			continue
+		}
+		attempt++
+
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", b.Address, timeout)
+		b.EndConnect()
+		if err == nil {
+			rtt := time.Since(start)
+			b.ObserveLatency(rtt)
+			b.ResetFailures()
+			if h.Observer != nil {
+				h.Observer.Connected(b, rtt)
+			}
+			return b, conn, nil
+		}
+
+		b.DecConn()
+		h.failed(b)
+		lastErr = err
+
+		logging.L().Warn("failed to dial backend",
+			zap.String("backend_address", b.Address),
+			zap.Int("attempt", attempt),
+			zap.Error(err),
+		)
+	}
+
+	return nil, nil, fmt.Errorf("all %d connect attempts failed: %w", h.ConnectRetries+1, lastErr)
+}
+
+// failed charges b a failed dial, marking it dead once the failures in a
+// row reach FailureThreshold.
+func (h *Handler) failed(b *backend.Backend) {
+	if failures := b.AddFailures(); h.FailureThreshold > 0 && failures >= int32(h.FailureThreshold) {
+		b.MarkDead()
+	}
+	if h.Observer != nil {
+		h.Observer.ConnectFailed(b)
+	}
+}
+
+// sendProxyHeader announces the original client to the backend when PROXY
+// protocol is enabled for it.
+func (h *Handler) sendProxyHeader(conn, backendConn net.Conn, b *backend.Backend) error {
+	version := b.ProxyProtocol()
+	if version == "" {
+		version = h.SendProxy
+	}
+	if version == "" || version == proxyproto.None {
+		return nil
+	}
+
+	timeout := time.Duration(h.Timeouts.ConnectTimeout) * time.Second
+	_ = backendConn.SetWriteDeadline(time.Now().Add(timeout))
+	defer backendConn.SetWriteDeadline(time.Time{})
+
+	var tlvs []proxyproto.TLV
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlvs = proxyproto.TLSTLVs(tlsConn.ConnectionState())
+	}
+
+	return proxyproto.WriteHeader(backendConn, version, conn.RemoteAddr(), conn.LocalAddr(), tlvs...)
+}
+
+// route picks the balancer for conn from its SNI, falling back to the
+// default one. Terminated TLS connections already know their server name;
+// otherwise the ClientHello is peeked and returned so it can be replayed.
+func (h *Handler) route(conn net.Conn) (Balancer, []byte) {
+	if h.routes == nil {
+		return h.Balancer, nil
+	}
+
+	var serverName string
+	var peeked []byte
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		serverName = tlsConn.ConnectionState().ServerName
+	} else {
+		serverName, peeked = peekClientHello(conn, time.Duration(h.Timeouts.ConnectTimeout)*time.Second)
+	}
+
+	if lb, ok := h.routes.match(serverName); ok {
+		return lb, peeked
 	}
+	return h.Balancer, peeked
 }
 
 func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
+	lb, peeked := h.route(conn)
+
 	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
-	backend, err := h.Balancer.Pick(clientIP)
+	backend, backendConn, err := h.connect(lb, clientIP)
 	if err != nil {
-		logging.L().Error("failed to pick backend", zap.Error(err))
+		logging.L().Error("failed to connect to backend", zap.String("client_address", conn.RemoteAddr().String()), zap.Error(err))
 		return
 	}
 	defer backend.DecConn()
+	defer backendConn.Close()
+	connected := time.Now()
 
-	timeout := time.Duration(h.Timeouts.ConnectTimeout) * time.Second
-	backendConn, err := net.DialTimeout("tcp", backend.Address, timeout)
-	if err != nil {
-		logging.L().Error("failed to connect to backend", zap.String("backend_address", backend.Address), zap.Error(err))
+	if err := h.sendProxyHeader(conn, backendConn, backend); err != nil {
+		logging.L().Error("failed to send PROXY header", zap.String("backend_address", backend.Address), zap.Error(err))
 		return
 	}
-	defer backendConn.Close()
 
-	pipe(ctx, conn, backendConn)
+	if len(peeked) > 0 {
+		if _, err := backendConn.Write(peeked); err != nil {
+			logging.L().Error("failed to replay ClientHello", zap.String("backend_address", backend.Address), zap.Error(err))
+			return
+		}
+	}
+
+	res := pipe(ctx, conn, backendConn, h.forwarder, idle.Timeouts{
+		Client:  time.Duration(h.Timeouts.ClientIdleSec) * time.Second,
+		Backend: time.Duration(h.Timeouts.BackendIdleSec) * time.Second,
+	})
+	res.sent += int64(len(peeked))
+	backend.AddTraffic(res.sent, res.received)
+	if h.Observer != nil {
+		h.Observer.Closed(backend, time.Since(connected), errors.Is(res.backendErr, syscall.ECONNRESET))
+	}
+
+	fields := []zap.Field{
+		zap.String("client_address", conn.RemoteAddr().String()),
+		zap.String("backend_address", backend.Address),
+		zap.String("reason", res.reason),
+		zap.Int64("bytes_sent", res.sent),
+		zap.Int64("bytes_received", res.received),
+	}
+	switch res.reason {
+	case idle.ClientIdle, idle.BackendIdle:
+		logging.L().Info("connection idle timeout", fields...)
+	default:
+		logging.L().Debug("connection closed", fields...)
+	}
 }
@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/proxyproto"
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoServer accepts connections and echoes everything back.
+func echoServer(t *testing.T) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln
+}
+
+// closedAddress returns an address nothing is listening on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestHandleRetriesNextBackend(t *testing.T) {
+	ln := echoServer(t)
+	defer ln.Close()
+
+	pool := backend.NewPool()
+	dead, _ := pool.AddBackend(closedAddress(t), 1)
+	live, _ := pool.AddBackend(ln.Addr().String(), 1)
+
+	h := NewHandler(balancer.NewRoundRobinBalancer(pool), config.TimeoutCfg{ConnectTimeout: 1})
+	h.ConnectRetries = 1
+
+	client, proxySide := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.Handle(context.Background(), proxySide)
+		close(done)
+	}()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(client, buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("Expected echo of hello, got %q", buf)
+	}
+
+	client.Close()
+	<-done
+
+	if dead.ConnCount() != 0 || live.ConnCount() != 0 {
+		t.Errorf("Expected connection counts to return to 0, got dead=%d live=%d", dead.ConnCount(), live.ConnCount())
+	}
+	if dead.Failures() != 1 {
+		t.Errorf("Expected the failed dial to be charged once, got %d failures", dead.Failures())
+	}
+	if live.Latency() == 0 || dead.Latency() != 0 {
+		t.Errorf("Expected only the successful dial to be observed, got live=%v dead=%v", live.Latency(), dead.Latency())
+	}
+}
+
+func TestHandleRetriesExhausted(t *testing.T) {
+	pool := backend.NewPool()
+	first, _ := pool.AddBackend(closedAddress(t), 1)
+	second, _ := pool.AddBackend(closedAddress(t), 1)
+
+	h := NewHandler(balancer.NewRoundRobinBalancer(pool), config.TimeoutCfg{ConnectTimeout: 1})
+	h.ConnectRetries = 5
+
+	_, _, err := h.connect(h.Balancer, "")
+	if err == nil {
+		t.Fatal("Expected error when every backend refuses")
+	}
+
+	if first.ConnCount() != 0 || second.ConnCount() != 0 {
+		t.Errorf("Expected connection counts to stay at 0, got %d and %d", first.ConnCount(), second.ConnCount())
+	}
+}
+
+// orderedBalancer picks the first backend not excluded, ignoring circuit
+// breakers as a pick racing another one can.
+type orderedBalancer []*backend.Backend
+
+func (o orderedBalancer) Pick(_ string, exclude ...string) (*backend.Backend, error) {
+	for _, b := range o {
+		if !slices.Contains(exclude, b.Address) {
+			b.IncConn()
+			return b, nil
+		}
+	}
+	return nil, errors.New("no backends")
+}
+
+func TestConnectSkipsSaturatedBackends(t *testing.T) {
+	ln := echoServer(t)
+	defer ln.Close()
+
+	full := backend.NewBackend("10.0.0.1:8080", 1, backend.WithLimits(backend.Limits{MaxPending: 1}))
+	if err := full.BeginConnect(); err != nil {
+		t.Fatalf("Failed to begin connect: %v", err)
+	}
+	dead := backend.NewBackend(closedAddress(t), 1)
+	live := backend.NewBackend(ln.Addr().String(), 1)
+
+	// One retry: the refused dial must not use it up
+	h := NewHandler(orderedBalancer{full, dead, live}, config.TimeoutCfg{ConnectTimeout: 1})
+	h.ConnectRetries = 1
+
+	b, conn, err := h.connect(h.Balancer, "")
+	if err != nil {
+		t.Fatalf("Expected the retry to reach the live backend, got %v", err)
+	}
+	conn.Close()
+	if b != live {
+		t.Errorf("Expected %s, got %s", live.Address, b.Address)
+	}
+	if full.ConnCount() != 0 || full.Failures() != 0 {
+		t.Errorf("Expected the saturated backend released and not charged, got %d connections and %d failures", full.ConnCount(), full.Failures())
+	}
+	if full.Overflows().Pending != 1 {
+		t.Errorf("Expected the refused dial counted as an overflow, got %+v", full.Overflows())
+	}
+}
+
+func TestConnectMarksDeadAtThreshold(t *testing.T) {
+	pool := backend.NewPool()
+	b, _ := pool.AddBackend(closedAddress(t), 1)
+
+	h := NewHandler(balancer.NewRoundRobinBalancer(pool), config.TimeoutCfg{ConnectTimeout: 1})
+	h.FailureThreshold = 2
+
+	for i, wantAlive := range []bool{true, false} {
+		if _, _, err := h.connect(h.Balancer, ""); err == nil {
+			t.Fatal("Expected the dial to fail")
+		}
+		if b.IsAlive() != wantAlive {
+			t.Errorf("After %d failed dials: expected alive %v, got %v", i+1, wantAlive, b.IsAlive())
+		}
+	}
+
+	// Without a threshold failed dials are only counted
+	other := backend.NewPool()
+	b, _ = other.AddBackend(closedAddress(t), 1)
+	h = NewHandler(balancer.NewRoundRobinBalancer(other), config.TimeoutCfg{ConnectTimeout: 1})
+	for range 3 {
+		_, _, _ = h.connect(h.Balancer, "")
+	}
+	if !b.IsAlive() || b.Failures() != 3 {
+		t.Errorf("Expected the backend alive with 3 failures, got alive %v with %d", b.IsAlive(), b.Failures())
+	}
+}
+
+func TestHandleSendsProxyHeader(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		line, _ := bufio.NewReader(c).ReadString('\n')
+		received <- line
+	}()
+
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend(ln.Addr().String(), 1, backend.WithProxyProtocol(proxyproto.V1))
+
+	h := NewHandler(balancer.NewRoundRobinBalancer(pool), config.TimeoutCfg{ConnectTimeout: 1})
+
+	client, proxySide := tcpPair(t)
+	defer client.Close()
+	go h.Handle(context.Background(), proxySide)
+
+	want := fmt.Sprintf("PROXY TCP4 127.0.0.1 127.0.0.1 %d %d\r\n",
+		proxySide.RemoteAddr().(*net.TCPAddr).Port,
+		proxySide.LocalAddr().(*net.TCPAddr).Port,
+	)
+	if got := <-received; got != want {
+		t.Errorf("Expected header %q, got %q", want, got)
+	}
+}
+
+// recordingObserver logs what the handler reports.
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(event string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+}
+
+func (o *recordingObserver) ConnectFailed(b *backend.Backend) {
+	o.record("connect_failed")
+}
+
+func (o *recordingObserver) Connected(b *backend.Backend, rtt time.Duration) {
+	o.record("connected")
+}
+
+func (o *recordingObserver) Closed(b *backend.Backend, lifetime time.Duration, reset bool) {
+	o.record(fmt.Sprintf("closed reset=%v", reset))
+}
+
+func TestHandleReportsToObserver(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Backend that resets the connection after the first read
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = c.Read(make([]byte, 16))
+		_ = c.(*net.TCPConn).SetLinger(0)
+		c.Close()
+	}()
+
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend(closedAddress(t), 1)
+	_, _ = pool.AddBackend(ln.Addr().String(), 1)
+
+	observer := &recordingObserver{}
+	h := NewHandler(balancer.NewRoundRobinBalancer(pool), config.TimeoutCfg{ConnectTimeout: 1})
+	h.ConnectRetries = 1
+	h.Observer = observer
+
+	client, proxySide := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.Handle(context.Background(), proxySide)
+		close(done)
+	}()
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, client)
+	client.Close()
+	<-done
+
+	want := []string{"connect_failed", "connected", "closed reset=true"}
+	if !slices.Equal(observer.events, want) {
+		t.Errorf("Expected events %v, got %v", want, observer.events)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"LoadBalancer/internal/logging"
 	"context"
 	"errors"
+	"io"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -12,14 +13,35 @@ import (
 	"go.uber.org/zap"
 )
 
+// Server is a listener that balances incoming traffic across backends.
+type Server interface {
+	Start() error
+	Stop(ctx context.Context) error
+}
+
 type Options struct {
-	IOUring bool
-	Timeout config.TimeoutCfg
+	IOUring        bool
+	Timeout        config.TimeoutCfg
+	ConnectRetries int
+	// Failures in a row that mark a backend dead, 0 never does
+	FailureThreshold int
+	// Default PROXY protocol version for backends that do not set their own
+	SendProxy   string
+	AcceptProxy config.AcceptProxyCfg
+	TLS         config.TLSCfg
+	// Balancers chosen by TLS server name; unmatched connections use the
+	// default balancer passed to NewProxy
+	SNIRoutes []SNIRoute
+	// Passive outlier detection, nil disables it
+	Observer Observer
 }
 
 type Proxy struct {
-	listener net.Listener
-	handler  *Handler
+	listener    net.Listener
+	handler     *Handler
+	ring        io.Closer      // non-nil when the io_uring data path is active
+	acceptProxy *proxyAcceptor // non-nil when PROXY headers are accepted
+	tls         *tlsTerminator // non-nil when TLS is terminated here
 
 	wg       sync.WaitGroup
 	stopOnce sync.Once
@@ -33,25 +55,70 @@ type Proxy struct {
 func NewProxy(address string, balancer Balancer, options Options) (*Proxy, error) {
 	var err error
 
+	var acceptProxy *proxyAcceptor
+	if options.AcceptProxy.Enabled {
+		acceptProxy, err = newProxyAcceptor(options.AcceptProxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var terminator *tlsTerminator
+	if options.TLS.Enabled {
+		terminator, err = newTLSTerminator(options.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	listener, err := net.Listen("tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
 	h := NewHandler(balancer, options.Timeout)
+	h.ConnectRetries = options.ConnectRetries
+	h.FailureThreshold = options.FailureThreshold
+	h.SendProxy = options.SendProxy
+	h.Observer = options.Observer
+	if len(options.SNIRoutes) > 0 {
+		h.routes = newSNIRouter(options.SNIRoutes)
+	}
+
+	var ring io.Closer
+	if options.IOUring {
+		l, fwd, r, err := useIOUring(listener)
+		if err != nil {
+			logging.L().Warn("io_uring unavailable, falling back to standard networking", zap.Error(err))
+		} else {
+			listener, h.forwarder, ring = l, fwd, r
+			logging.L().Info("Using io_uring data path")
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Proxy{
-		listener: listener,
-		handler:  h,
-		ctx:      ctx,
-		cancel:   cancel,
+		listener:    listener,
+		handler:     h,
+		ring:        ring,
+		acceptProxy: acceptProxy,
+		tls:         terminator,
+		ctx:         ctx,
+		cancel:      cancel,
 	}, nil
 }
 
 func (p *Proxy) Start() error {
 	logging.L().Info("Proxy Listening", zap.String("port", p.listener.Addr().String()))
 
+	if p.tls != nil {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.tls.store.Watch(p.ctx, p.tls.reload)
+		}()
+	}
+
 	for {
 		conn, err := p.listener.Accept()
 		if err != nil {
@@ -74,12 +141,40 @@ func (p *Proxy) Start() error {
 
 func (p *Proxy) handleConnection(conn net.Conn) {
 	defer p.wg.Done()
+
+	if p.acceptProxy != nil {
+		wrapped, err := p.acceptProxy.wrap(conn)
+		if err != nil {
+			logging.L().Warn("Rejected connection without valid PROXY header", zap.String("peer_address", conn.RemoteAddr().String()), zap.Error(err))
+			conn.Close()
+			return
+		}
+		conn = wrapped
+	}
+
+	// The PROXY header, if any, precedes the TLS handshake
+	if p.tls != nil {
+		tlsConn, err := p.tls.handshake(p.ctx, conn)
+		if err != nil {
+			logging.L().Warn("TLS handshake failed", zap.String("client_address", conn.RemoteAddr().String()), zap.Error(err))
+			conn.Close()
+			return
+		}
+		conn = tlsConn
+	}
+
 	p.handler.Handle(p.ctx, conn)
 }
 
 func (p *Proxy) Stop(ctx context.Context) error {
 	var err error
 
+	// Connections still on the ring when ctx runs out get their operations
+	// cancelled
+	if p.ring != nil {
+		defer p.ring.Close()
+	}
+
 	p.stopOnce.Do(func() {
 		atomic.StoreInt32(&p.stopped, 1)
 		err = p.listener.Close()
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// SNIRoute sends TLS connections for ServerName to Balancer. ServerName may
+// be a wildcard such as "*.example.com", which matches one extra label.
+type SNIRoute struct {
+	ServerName string
+	Balancer   Balancer
+}
+
+type sniRouter struct {
+	exact    map[string]Balancer
+	wildcard map[string]Balancer // keyed by the suffix, e.g. ".example.com"
+}
+
+func newSNIRouter(routes []SNIRoute) *sniRouter {
+	r := &sniRouter{
+		exact:    make(map[string]Balancer),
+		wildcard: make(map[string]Balancer),
+	}
+	for _, route := range routes {
+		name := strings.ToLower(route.ServerName)
+		if suffix, ok := strings.CutPrefix(name, "*"); ok {
+			r.wildcard[suffix] = route.Balancer
+		} else {
+			r.exact[name] = route.Balancer
+		}
+	}
+	return r
+}
+
+// match looks the server name up exactly, then as a wildcard.
+func (r *sniRouter) match(serverName string) (Balancer, bool) {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return nil, false
+	}
+	if b, ok := r.exact[name]; ok {
+		return b, true
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if b, ok := r.wildcard[name[i:]]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+var errClientHelloRead = errors.New("client hello read")
+
+// sniffConn lets the TLS stack read from the client while recording every
+// byte, and swallows anything it tries to send back.
+type sniffConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c sniffConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (sniffConn) Write(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// peekClientHello reads the ClientHello from conn without answering it and
+// returns the requested server name along with every byte consumed, which
+// must be replayed to the backend. Non-TLS clients and clients without SNI
+// yield an empty name.
+func peekClientHello(conn net.Conn, timeout time.Duration) (string, []byte) {
+	var peeked bytes.Buffer
+	var serverName string
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_ = tls.Server(sniffConn{Conn: conn, r: io.TeeReader(conn, &peeked)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+
+	return serverName, peeked.Bytes()
+}
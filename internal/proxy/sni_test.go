@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPeekClientHello(t *testing.T) {
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	// The handshake never completes, the client just has to send its hello
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: "api.example.com"}).Handshake()
+	}()
+
+	name, peeked := peekClientHello(server, time.Second)
+	if name != "api.example.com" {
+		t.Errorf("Expected server name %q, got %q", "api.example.com", name)
+	}
+	if len(peeked) == 0 || peeked[0] != 0x16 {
+		t.Errorf("Expected peeked bytes to start with a handshake record, got % x", peeked[:min(len(peeked), 8)])
+	}
+}
+
+func TestPeekClientHelloNotTLS(t *testing.T) {
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	request := []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if _, err := client.Write(request); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	name, peeked := peekClientHello(server, time.Second)
+	if name != "" {
+		t.Errorf("Expected no server name, got %q", name)
+	}
+	if !bytes.HasPrefix(request, peeked) || len(peeked) == 0 {
+		t.Errorf("Expected peeked bytes to be a prefix of the request, got %q", peeked)
+	}
+}
+
+func TestSNIRouterMatch(t *testing.T) {
+	api := balancer.NewRoundRobinBalancer(backend.NewPool())
+	wild := balancer.NewRoundRobinBalancer(backend.NewPool())
+	r := newSNIRouter([]SNIRoute{
+		{ServerName: "api.example.com", Balancer: api},
+		{ServerName: "*.example.com", Balancer: wild},
+	})
+
+	tests := []struct {
+		name string
+		want Balancer
+	}{
+		{"api.example.com", api},
+		{"API.example.com.", api},
+		{"www.example.com", wild},
+		{"a.b.example.com", nil},
+		{"example.com", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		got, ok := r.match(tt.name)
+		if (tt.want == nil) == ok || (ok && got != tt.want) {
+			t.Errorf("Route for %q: expected %p, got %p (matched %v)", tt.name, tt.want, got, ok)
+		}
+	}
+}
+
+func TestHandleRoutesBySNI(t *testing.T) {
+	defaultLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer defaultLn.Close()
+
+	apiLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer apiLn.Close()
+
+	defaultPool := backend.NewPool()
+	_, _ = defaultPool.AddBackend(defaultLn.Addr().String(), 1)
+	apiPool := backend.NewPool()
+	_, _ = apiPool.AddBackend(apiLn.Addr().String(), 1)
+
+	h := NewHandler(balancer.NewRoundRobinBalancer(defaultPool), config.TimeoutCfg{ConnectTimeout: 1})
+	h.routes = newSNIRouter([]SNIRoute{
+		{ServerName: "api.example.com", Balancer: balancer.NewRoundRobinBalancer(apiPool)},
+	})
+
+	client, proxySide := tcpPair(t)
+	defer client.Close()
+	go h.Handle(context.Background(), proxySide)
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: "api.example.com"}).Handshake()
+	}()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := apiLn.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	select {
+	case c := <-accepted:
+		defer c.Close()
+		// The backend sees the original ClientHello, untouched
+		name, _ := peekClientHello(c, time.Second)
+		if name != "api.example.com" {
+			t.Errorf("Expected replayed hello for %q, got %q", "api.example.com", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected connection to be routed to the api pool")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build linux
+
+package proxy
+
+import "testing"
+
+func BenchmarkPipe_Splice(b *testing.B) {
+	benchmarkPipe(b, spliceForwarder{})
+}
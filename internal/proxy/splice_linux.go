@@ -0,0 +1,120 @@
+//go:build linux
+
+package proxy
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Same ceiling the runtime uses for its own splice path
+const maxSpliceSize = 1 << 20
+
+func defaultForwarder() forwarder {
+	return spliceForwarder{}
+}
+
+// spliceForwarder moves bytes socket -> pipe -> socket with splice(2) so the
+// payload never enters user space. Readiness waits go through the netpoller,
+// which keeps deadlines and therefore ctx cancellation working.
+type spliceForwarder struct{}
+
+func (spliceForwarder) forward(dst, src net.Conn, onData func(n int64)) (int64, error) {
+	srcRaw, ok := rawConn(src)
+	if !ok {
+		return streamForwarder{}.forward(dst, src, onData)
+	}
+	dstRaw, ok := rawConn(dst)
+	if !ok {
+		return streamForwarder{}.forward(dst, src, onData)
+	}
+
+	var fds [2]int
+	if err := unix.Pipe2(fds[:], unix.O_NONBLOCK|unix.O_CLOEXEC); err != nil {
+		return streamForwarder{}.forward(dst, src, onData)
+	}
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+	_, _ = unix.FcntlInt(uintptr(fds[0]), unix.F_SETPIPE_SZ, maxSpliceSize)
+
+	var written int64
+	for {
+		n, err := spliceFrom(srcRaw, fds[1])
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, nil
+		}
+		onData(n)
+
+		for n > 0 {
+			m, err := spliceTo(dstRaw, fds[0], n)
+			written += m
+			if err != nil {
+				return written, err
+			}
+			n -= m
+		}
+	}
+}
+
+func (spliceForwarder) interrupt(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now())
+}
+
+// spliceFrom drains up to maxSpliceSize bytes from the socket into the pipe.
+// A zero count means the peer closed its write side.
+func spliceFrom(src syscall.RawConn, pipeW int) (int64, error) {
+	var n int64
+	var serr error
+	err := src.Read(func(fd uintptr) bool {
+		for {
+			n, serr = unix.Splice(int(fd), nil, pipeW, nil, maxSpliceSize, unix.SPLICE_F_MOVE|unix.SPLICE_F_NONBLOCK)
+			if serr != unix.EINTR {
+				return serr != unix.EAGAIN
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, serr
+}
+
+// spliceTo moves up to n buffered bytes from the pipe into the socket.
+func spliceTo(dst syscall.RawConn, pipeR int, n int64) (int64, error) {
+	var m int64
+	var serr error
+	err := dst.Write(func(fd uintptr) bool {
+		for {
+			m, serr = unix.Splice(pipeR, nil, int(fd), nil, int(n), unix.SPLICE_F_MOVE|unix.SPLICE_F_NONBLOCK)
+			if serr != unix.EINTR {
+				return serr != unix.EAGAIN
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if serr != nil {
+		return 0, serr
+	}
+	return m, nil
+}
+
+func rawConn(conn net.Conn) (syscall.RawConn, bool) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, false
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+	return raw, true
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package proxy
+
+import "testing"
+
+// testForwarders returns every forwarder this platform can run, keyed by
+// name. The io_uring one is left out where the kernel lacks support.
+func testForwarders(tb testing.TB) map[string]forwarder {
+	fwds := map[string]forwarder{
+		"stream": streamForwarder{},
+		"splice": spliceForwarder{},
+	}
+
+	ring, err := newIOURing(uringEntries)
+	if err != nil {
+		tb.Logf("io_uring unavailable: %v", err)
+		return fwds
+	}
+	tb.Cleanup(func() { _ = ring.Close() })
+	fwds["io_uring"] = uringForwarder{ring: ring}
+	return fwds
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package proxy
+
+func defaultForwarder() forwarder {
+	return streamForwarder{}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package proxy
+
+import "testing"
+
+// testForwarders returns every forwarder this platform can run, keyed by
+// name.
+func testForwarders(tb testing.TB) map[string]forwarder {
+	return map[string]forwarder{"stream": streamForwarder{}}
+}
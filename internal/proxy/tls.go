@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/tlsconfig"
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// tlsTerminator decrypts client connections before they are balanced.
+type tlsTerminator struct {
+	store   *tlsconfig.Store
+	config  *tls.Config
+	timeout time.Duration
+	reload  time.Duration
+}
+
+func newTLSTerminator(cfg config.TLSCfg) (*tlsTerminator, error) {
+	tlsConfig, store, err := tlsconfig.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsTerminator{
+		store:   store,
+		config:  tlsConfig,
+		timeout: time.Duration(cfg.HandshakeTimeoutSec) * time.Second,
+		reload:  time.Duration(cfg.ReloadIntervalSec) * time.Second,
+	}, nil
+}
+
+func (t *tlsTerminator) handshake(ctx context.Context, conn net.Conn) (*tls.Conn, error) {
+	tlsConn := tls.Server(conn, t.config)
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/proxyproto"
+	"LoadBalancer/internal/tlsconfig/tlsconfigtest"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProxyTerminatesTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Plaintext backend that reads the PROXY header, then echoes
+	headers := make(chan *proxyproto.Header, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		header, err := proxyproto.ReadHeader(c)
+		if err != nil {
+			return
+		}
+		headers <- header
+		_, _ = io.Copy(c, c)
+	}()
+
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend(ln.Addr().String(), 1, backend.WithProxyProtocol(proxyproto.V2))
+
+	p, err := NewProxy("127.0.0.1:0", balancer.NewRoundRobinBalancer(pool), Options{
+		Timeout: config.TimeoutCfg{ConnectTimeout: 1},
+		TLS: config.TLSCfg{
+			Enabled:             true,
+			Certificates:        []config.CertCfg{tlsconfigtest.WriteCert(t, t.TempDir(), "site", "secure.example.com")},
+			MinVersion:          "1.2",
+			HandshakeTimeoutSec: 1,
+			ReloadIntervalSec:   1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	go p.Start()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = p.Stop(ctx)
+	}()
+
+	client, err := tls.Dial("tcp", p.listener.Addr().String(), &tls.Config{
+		ServerName:         "secure.example.com",
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("TLS handshake failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(client, buf); err != nil {
+		t.Fatalf("Failed to read echo: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("Expected echo %q, got %q", "hello", buf)
+	}
+
+	header := <-headers
+	var authority string
+	for _, tlv := range header.TLVs {
+		if tlv.Type == proxyproto.TypeAuthority {
+			authority = string(tlv.Value)
+		}
+	}
+	if authority != "secure.example.com" {
+		t.Errorf("Expected authority TLV %q, got %q", "secure.example.com", authority)
+	}
+}
@@ -0,0 +1,329 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/idle"
+	"LoadBalancer/internal/logging"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const maxDatagramSize = 64 * 1024
+
+// maxQueuedDatagrams bounds what a flow may send while its session is
+// still being opened; later datagrams are dropped.
+const maxQueuedDatagrams = 64
+
+// udpSession is one client flow pinned to a backend. Datagrams go out on a
+// socket connected to the backend and replies on it are relayed back.
+type udpSession struct {
+	client     *net.UDPAddr
+	backend    *backend.Backend // nil, like conn, until the session is opened
+	conn       *net.UDPConn
+	lastActive atomic.Int64 // unix nanos
+	closeOnce  sync.Once
+
+	// Guarded by UDPProxy.mu: datagrams that came in while the session was
+	// being opened, in order, and whether they have all been sent on
+	queued [][]byte
+	open   bool
+}
+
+func (s *udpSession) touch() {
+	s.lastActive.Store(time.Now().UnixNano())
+}
+
+func (s *udpSession) close() {
+	s.closeOnce.Do(func() {
+		if s.conn == nil {
+			return
+		}
+		s.conn.Close()
+		s.backend.DecConn()
+	})
+}
+
+// forward sends a client datagram on to the session's backend.
+func (s *udpSession) forward(datagram []byte) {
+	if _, err := s.conn.Write(datagram); err != nil {
+		logging.L().Warn("failed to forward datagram", zap.String("backend_address", s.backend.Address), zap.Error(err))
+		return
+	}
+	s.touch()
+	s.backend.AddTraffic(int64(len(datagram)), 0)
+}
+
+// UDPProxy balances datagram traffic. Each client address gets its own
+// session, which expires after the client idle timeout or as soon as its
+// backend is marked dead so the next datagram is re-balanced.
+type UDPProxy struct {
+	conn     *net.UDPConn
+	balancer Balancer
+	idle     time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	stopped int32
+}
+
+func NewUDPProxy(address string, balancer Balancer, options Options) (*UDPProxy, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &UDPProxy{
+		conn:     conn,
+		balancer: balancer,
+		idle:     time.Duration(options.Timeout.ClientIdleSec) * time.Second,
+		sessions: make(map[string]*udpSession),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+func (p *UDPProxy) Start() error {
+	logging.L().Info("UDP Proxy Listening", zap.String("port", p.conn.LocalAddr().String()))
+
+	p.wg.Add(1)
+	go p.expireSessions()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, client, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			if atomic.LoadInt32(&p.stopped) == 1 || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			logging.L().Error("UDP read error", zap.Error(err))
+			continue
+		}
+
+		if s := p.session(client, buf[:n]); s != nil {
+			s.forward(buf[:n])
+		}
+	}
+}
+
+// session returns the open flow of client for datagram to be forwarded on.
+// A new flow gets a session that is opened off the read loop, so picking
+// and resolving its backend does not hold up other clients; until then
+// its datagrams are queued and nil is returned.
+func (p *UDPProxy) session(client *net.UDPAddr, datagram []byte) *udpSession {
+	key := client.String()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Stop closes every session it sees, one added after that would leak
+	if atomic.LoadInt32(&p.stopped) == 1 {
+		return nil
+	}
+	s, ok := p.sessions[key]
+	if ok && s.open {
+		return s
+	}
+	if !ok {
+		s = &udpSession{client: client}
+		p.sessions[key] = s
+		p.wg.Add(1)
+		go p.open(key, s)
+	}
+	if len(s.queued) < maxQueuedDatagrams {
+		s.queued = append(s.queued, append([]byte(nil), datagram...))
+	}
+	return nil
+}
+
+// open connects s to a freshly picked backend, sends on what was queued
+// meanwhile and starts relaying replies.
+func (p *UDPProxy) open(key string, s *udpSession) {
+	defer p.wg.Done()
+
+	b, conn, err := p.dial(s.client)
+
+	p.mu.Lock()
+	// Stop, or a sweep, dropped the session while it was being opened
+	if p.sessions[key] != s {
+		p.mu.Unlock()
+		if err == nil {
+			conn.Close()
+			b.DecConn()
+		}
+		return
+	}
+	if err != nil {
+		delete(p.sessions, key)
+		p.mu.Unlock()
+		logging.L().Error("failed to open UDP session", zap.String("client_address", key), zap.Error(err))
+		return
+	}
+	s.backend, s.conn = b, conn
+	s.touch()
+	p.wg.Add(1)
+	go p.relayReplies(s)
+	p.mu.Unlock()
+
+	logging.L().Debug("UDP session opened", zap.String("client_address", key), zap.String("backend_address", b.Address))
+
+	// The read loop keeps queueing until the queue is drained, so datagrams
+	// stay in order
+	for {
+		p.mu.Lock()
+		queued := s.queued
+		s.queued = nil
+		s.open = len(queued) == 0
+		p.mu.Unlock()
+		if len(queued) == 0 {
+			return
+		}
+		for _, datagram := range queued {
+			s.forward(datagram)
+		}
+	}
+}
+
+// dial picks a backend for client and connects a socket to it.
+func (p *UDPProxy) dial(client *net.UDPAddr) (*backend.Backend, *net.UDPConn, error) {
+	b, err := p.balancer.Pick(client.IP.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", b.Address)
+	if err != nil {
+		b.DecConn()
+		return nil, nil, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		b.DecConn()
+		return nil, nil, err
+	}
+	return b, conn, nil
+}
+
+// relayReplies copies datagrams from the backend back to the client until
+// the session is closed.
+func (p *UDPProxy) relayReplies(s *udpSession) {
+	defer p.wg.Done()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// ICMP errors (e.g. port unreachable) surface here, keep the session
+			// until it expires or the health checker takes the backend out
+			continue
+		}
+
+		if _, err := p.conn.WriteToUDP(buf[:n], s.client); err != nil {
+			logging.L().Warn("failed to relay datagram to client", zap.String("client_address", s.client.String()), zap.Error(err))
+			continue
+		}
+		s.touch()
+		s.backend.AddTraffic(0, int64(n))
+	}
+}
+
+func (p *UDPProxy) expireSessions() {
+	defer p.wg.Done()
+
+	interval := p.idle / 2
+	if interval <= 0 || interval > time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.sweep(now)
+		}
+	}
+}
+
+// sweep closes sessions that went idle or whose backend is no longer
+// alive or was ejected.
+func (p *UDPProxy) sweep(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, s := range p.sessions {
+		if s.conn == nil {
+			continue // still being opened
+		}
+		idled := p.idle > 0 && now.Sub(time.Unix(0, s.lastActive.Load())) >= p.idle
+		if !idled && s.backend.Available() {
+			continue
+		}
+
+		delete(p.sessions, key)
+		s.close()
+
+		reason := idle.ClientIdle
+		if !idled {
+			reason = "backend_dead"
+		}
+		logging.L().Debug("UDP session closed", zap.String("client_address", key), zap.String("backend_address", s.backend.Address), zap.String("reason", reason))
+	}
+}
+
+func (p *UDPProxy) Stop(ctx context.Context) error {
+	var err error
+
+	p.stopOnce.Do(func() {
+		atomic.StoreInt32(&p.stopped, 1)
+		err = p.conn.Close()
+		p.cancel()
+
+		p.mu.Lock()
+		for key, s := range p.sessions {
+			delete(p.sessions, key)
+			s.close()
+		}
+		p.mu.Unlock()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logging.L().Info("UDP Proxy Closed")
+		return err
+	case <-ctx.Done():
+		logging.L().Info("Context Done")
+		return ctx.Err()
+	}
+}
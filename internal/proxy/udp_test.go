@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// udpEchoServer echoes every datagram back to its sender.
+func udpEchoServer(t *testing.T) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	go func() {
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.WriteToUDP(buf[:n], addr)
+		}
+	}()
+	return conn
+}
+
+func startUDPProxy(t *testing.T, pool *backend.Pool) *UDPProxy {
+	t.Helper()
+
+	p, err := NewUDPProxy("127.0.0.1:0", balancer.NewIPHashBalancer(pool), Options{
+		Timeout: config.TimeoutCfg{ClientIdleSec: 30},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create UDP proxy: %v", err)
+	}
+	go p.Start()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = p.Stop(ctx)
+	})
+	return p
+}
+
+func roundTrip(t *testing.T, client *net.UDPConn, msg string) {
+	t.Helper()
+
+	if _, err := client.Write([]byte(msg)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 64)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	if string(buf[:n]) != msg {
+		t.Errorf("Expected %q, got %q", msg, buf[:n])
+	}
+}
+
+func TestUDPProxyForwardsReplies(t *testing.T) {
+	echo := udpEchoServer(t)
+	defer echo.Close()
+
+	pool := backend.NewPool()
+	b, _ := pool.AddBackend(echo.LocalAddr().String(), 1)
+
+	p := startUDPProxy(t, pool)
+
+	client, err := net.DialUDP("udp", nil, p.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer client.Close()
+
+	roundTrip(t, client, "ping")
+	roundTrip(t, client, "pong")
+
+	if got := b.ConnCount(); got != 1 {
+		t.Errorf("Expected 1 session on the backend, got %d", got)
+	}
+	// Reply bytes are counted just after the relay writes to the client
+	deadline := time.Now().Add(time.Second)
+	for b.BytesReceived() < 8 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if b.BytesSent() != 8 || b.BytesReceived() != 8 {
+		t.Errorf("Expected 8 bytes each way, got %d sent and %d received", b.BytesSent(), b.BytesReceived())
+	}
+}
+
+func TestUDPProxyExpiresSessions(t *testing.T) {
+	echo := udpEchoServer(t)
+	defer echo.Close()
+
+	pool := backend.NewPool()
+	b, _ := pool.AddBackend(echo.LocalAddr().String(), 1)
+
+	p := startUDPProxy(t, pool)
+
+	client, err := net.DialUDP("udp", nil, p.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer client.Close()
+
+	roundTrip(t, client, "ping")
+
+	// Still fresh, nothing to expire
+	p.sweep(time.Now())
+	if got := b.ConnCount(); got != 1 {
+		t.Fatalf("Expected session to survive, got %d active", got)
+	}
+
+	p.sweep(time.Now().Add(p.idle))
+	if got := b.ConnCount(); got != 0 {
+		t.Errorf("Expected idle session to expire, got %d active", got)
+	}
+
+	// The next datagram opens a new session
+	roundTrip(t, client, "again")
+	if got := b.ConnCount(); got != 1 {
+		t.Errorf("Expected a new session, got %d active", got)
+	}
+}
+
+func TestUDPProxyDropsSessionsOnDeadBackend(t *testing.T) {
+	echo := udpEchoServer(t)
+	defer echo.Close()
+
+	pool := backend.NewPool()
+	b, _ := pool.AddBackend(echo.LocalAddr().String(), 1)
+
+	p := startUDPProxy(t, pool)
+
+	client, err := net.DialUDP("udp", nil, p.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer client.Close()
+
+	roundTrip(t, client, "ping")
+
+	b.MarkDead()
+	p.sweep(time.Now())
+
+	p.mu.Lock()
+	n := len(p.sessions)
+	p.mu.Unlock()
+	if n != 0 {
+		t.Errorf("Expected session on dead backend to be dropped, got %d", n)
+	}
+}
+
+// gatedBalancer holds up picks for one key until it is released.
+type gatedBalancer struct {
+	Balancer
+	key  string
+	gate chan struct{}
+}
+
+func (g *gatedBalancer) Pick(key string, exclude ...string) (*backend.Backend, error) {
+	if key == g.key {
+		<-g.gate
+	}
+	return g.Balancer.Pick(key, exclude...)
+}
+
+func TestUDPProxyOpensSessionsOffTheReadLoop(t *testing.T) {
+	echo := udpEchoServer(t)
+	defer echo.Close()
+
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend(echo.LocalAddr().String(), 1)
+
+	slow, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2)})
+	if err != nil {
+		t.Skipf("127.0.0.2 unavailable: %v", err)
+	}
+	defer slow.Close()
+
+	lb := &gatedBalancer{Balancer: balancer.NewIPHashBalancer(pool), key: "127.0.0.2", gate: make(chan struct{})}
+	p, err := NewUDPProxy("127.0.0.1:0", lb, Options{Timeout: config.TimeoutCfg{ClientIdleSec: 30}})
+	if err != nil {
+		t.Fatalf("Failed to create UDP proxy: %v", err)
+	}
+	go p.Start()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = p.Stop(ctx)
+	}()
+	proxyAddr := p.conn.LocalAddr().(*net.UDPAddr)
+
+	// The slow client's session is stuck picking a backend
+	for _, msg := range []string{"one", "two", "three"} {
+		if _, err := slow.WriteToUDP([]byte(msg), proxyAddr); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	// Other clients are served meanwhile
+	client, err := net.DialUDP("udp", nil, proxyAddr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer client.Close()
+	roundTrip(t, client, "ping")
+
+	// Once picked, the slow client's datagrams arrive in order
+	close(lb.gate)
+	_ = slow.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 64)
+	for _, want := range []string{"one", "two", "three"} {
+		n, _, err := slow.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+		if string(buf[:n]) != want {
+			t.Errorf("Expected %q, got %q", want, buf[:n])
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+
+package proxy
+
+import "testing"
+
+func BenchmarkPipe_IOUring(b *testing.B) {
+	ring, err := newIOURing(uringEntries)
+	if err != nil {
+		b.Skipf("io_uring unavailable: %v", err)
+	}
+	defer ring.Close()
+
+	benchmarkPipe(b, uringForwarder{ring: ring})
+}
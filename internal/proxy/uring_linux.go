@@ -0,0 +1,721 @@
+//go:build linux
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Minimal io_uring bindings. Only the opcodes the proxy needs are wired up:
+// ACCEPT for the listener, RECV/SEND for the data path and POLL_ADD as a
+// fallback for kernels that hand EAGAIN back on non-blocking sockets.
+const (
+	uringOpPollAdd = 6
+	uringOpAccept  = 13
+	uringOpSend    = 26
+	uringOpRecv    = 27
+
+	uringFeatSingleMmap = 1 << 0
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringRegisterEventFD = 4
+	uringRegisterProbe   = 8
+	uringOpSupported     = 1 << 0
+
+	uringEntries = 256
+	uringBufSize = 64 * 1024
+)
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFD uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	opFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFDIn  int32
+	addr3       uint64
+	_           uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+type uringProbeOp struct {
+	op    uint8
+	resv  uint8
+	flags uint16
+	resv2 uint32
+}
+
+type uringProbe struct {
+	lastOp uint8
+	opsLen uint8
+	resv   uint16
+	resv2  [3]uint32
+	ops    [256]uringProbeOp
+}
+
+// uringAbandoned is handed to the callers of operations still in flight
+// when the ring is closed. Their completions are never reaped, so the
+// kernel may go on using their buffers for a while.
+const uringAbandoned = math.MinInt32
+
+var errUringAbandoned = fmt.Errorf("io_uring closed with the operation in flight: %w", unix.ECANCELED)
+
+var uringBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, uringBufSize)
+		return &b
+	},
+}
+
+// ioURing is a single shared ring. Callers write their SQEs under mu, which
+// is only held for that, and whoever finds no submission under way submits
+// every queued entry with one io_uring_enter. Completions are handed back
+// by that submitter when they happen inline, or by a reaper goroutine woken
+// through an eventfd on the netpoller, so no thread sits blocked in the
+// kernel waiting for them.
+type ioURing struct {
+	fd int
+
+	sqRing []byte
+	cqRing []byte
+	sqeMem []byte
+
+	sqHead    *uint32
+	sqTail    *uint32
+	sqMask    uint32
+	sqEntries uint32
+	sqArray   []uint32
+	sqes      []uringSQE
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []uringCQE
+
+	mu     sync.Mutex // guards writing the submission queue, closed and err
+	closed bool
+	err    error // why submitting broke, nothing is submitted after it is set
+
+	// Callers that want their entries submitted. The one that takes it from
+	// zero submits, including entries queued while it is in the kernel.
+	submitters atomic.Int32
+
+	cqMu   sync.Mutex // guards consuming the completion queue
+	events *os.File   // eventfd the kernel signals on every completion
+
+	pmu     sync.Mutex // guards pending and nextID
+	pending map[uint64]chan int32
+	nextID  uint64
+
+	done   chan struct{} // closed when the reaper exits
+	broken chan struct{} // closed when err is set
+}
+
+func newIOURing(entries uint32) (*ioURing, error) {
+	var params uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+
+	r := &ioURing{
+		fd:      int(fd),
+		pending: make(map[uint64]chan int32),
+		done:    make(chan struct{}),
+		broken:  make(chan struct{}),
+	}
+
+	if err := r.probe(); err != nil {
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+
+	if err := r.mmap(&params); err != nil {
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+
+	if err := r.registerEvents(); err != nil {
+		r.unmap()
+		_ = unix.Close(r.fd)
+		return nil, err
+	}
+
+	go r.reap()
+	return r, nil
+}
+
+// probe makes sure the kernel knows every opcode the proxy relies on.
+func (r *ioURing) probe() error {
+	var p uringProbe
+	_, _, errno := unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), uringRegisterProbe, uintptr(unsafe.Pointer(&p)), uintptr(len(p.ops)), 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("io_uring probe: %w", errno)
+	}
+
+	for _, op := range []uint8{uringOpPollAdd, uringOpAccept, uringOpSend, uringOpRecv} {
+		if op > p.lastOp || p.ops[op].flags&uringOpSupported == 0 {
+			return fmt.Errorf("io_uring opcode %d not supported by kernel", op)
+		}
+	}
+	return nil
+}
+
+// registerEvents has the kernel signal an eventfd for every completion.
+// The eventfd is non-blocking, so reading it parks only the reaper
+// goroutine.
+func (r *ioURing) registerEvents() error {
+	efd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("eventfd: %w", err)
+	}
+	_, _, errno := unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), uringRegisterEventFD, uintptr(unsafe.Pointer(&efd)), 1, 0, 0)
+	if errno != 0 {
+		_ = unix.Close(efd)
+		return fmt.Errorf("io_uring register eventfd: %w", errno)
+	}
+	r.events = os.NewFile(uintptr(efd), "io_uring-events")
+	return nil
+}
+
+func (r *ioURing) mmap(p *uringParams) error {
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	single := p.features&uringFeatSingleMmap != 0
+	if single && cqSize > sqSize {
+		sqSize = cqSize
+	}
+
+	var err error
+	r.sqRing, err = unix.Mmap(r.fd, uringOffSQRing, sqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return fmt.Errorf("mmap sq ring: %w", err)
+	}
+
+	if single {
+		r.cqRing = r.sqRing
+	} else {
+		r.cqRing, err = unix.Mmap(r.fd, uringOffCQRing, cqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+		if err != nil {
+			_ = unix.Munmap(r.sqRing)
+			return fmt.Errorf("mmap cq ring: %w", err)
+		}
+	}
+
+	sqeSize := int(p.sqEntries) * int(unsafe.Sizeof(uringSQE{}))
+	r.sqeMem, err = unix.Mmap(r.fd, uringOffSQEs, sqeSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		r.unmap()
+		return fmt.Errorf("mmap sqes: %w", err)
+	}
+
+	r.sqHead = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.head]))
+	r.sqTail = (*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.tail]))
+	r.sqMask = *(*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.ringMask]))
+	r.sqEntries = *(*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.ringEntries]))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&r.sqRing[p.sqOff.array])), p.sqEntries)
+	r.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+
+	r.cqHead = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.head]))
+	r.cqTail = (*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.tail]))
+	r.cqMask = *(*uint32)(unsafe.Pointer(&r.cqRing[p.cqOff.ringMask]))
+	r.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&r.cqRing[p.cqOff.cqes])), p.cqEntries)
+	return nil
+}
+
+func (r *ioURing) unmap() {
+	if r.sqeMem != nil {
+		_ = unix.Munmap(r.sqeMem)
+	}
+	if r.cqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		_ = unix.Munmap(r.cqRing)
+	}
+	if r.sqRing != nil {
+		_ = unix.Munmap(r.sqRing)
+	}
+}
+
+// enter submits toSubmit queued entries without waiting for completions.
+func (r *ioURing) enter(toSubmit uint32) error {
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(toSubmit), 0, 0, 0, 0)
+		switch errno {
+		case 0:
+			return nil
+		case unix.EINTR:
+			continue
+		case unix.EAGAIN, unix.EBUSY:
+			// Completion queue is backed up, drain it before trying again
+			r.complete()
+			runtime.Gosched()
+			continue
+		default:
+			return errno
+		}
+	}
+}
+
+// submit queues a single SQE and blocks until its completion arrives. The
+// returned value is the raw CQE result (negative errno on failure).
+func (r *ioURing) submit(prep func(sqe *uringSQE)) (int32, error) {
+	ch := make(chan int32, 1)
+	if err := r.queue(ch, prep); err != nil {
+		return 0, err
+	}
+	r.flush()
+	res := <-ch
+	if res == uringAbandoned {
+		return 0, errUringAbandoned
+	}
+	return res, nil
+}
+
+// queue writes an SQE for an operation whose result is sent to ch.
+func (r *ioURing) queue(ch chan int32, prep func(sqe *uringSQE)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reserve(); err != nil {
+		return err
+	}
+
+	r.pmu.Lock()
+	r.nextID++
+	id := r.nextID
+	r.pending[id] = ch
+	r.pmu.Unlock()
+
+	r.write(id, prep)
+	return nil
+}
+
+// reserve waits for room in the submission queue. Callers must hold mu,
+// which is released while the queue is being submitted.
+func (r *ioURing) reserve() error {
+	for {
+		if r.closed {
+			return net.ErrClosed
+		}
+		if r.err != nil {
+			return r.err
+		}
+		if *r.sqTail-atomic.LoadUint32(r.sqHead) < r.sqEntries {
+			return nil
+		}
+		r.mu.Unlock()
+		r.flush()
+		runtime.Gosched()
+		r.mu.Lock()
+	}
+}
+
+// write fills the next SQE and makes it visible to the kernel. Callers
+// must hold mu and have reserved room.
+func (r *ioURing) write(id uint64, prep func(sqe *uringSQE)) {
+	tail := *r.sqTail
+	idx := tail & r.sqMask
+	sqe := &r.sqes[idx]
+	*sqe = uringSQE{}
+	prep(sqe)
+	sqe.userData = id
+	r.sqArray[idx] = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+}
+
+// flush submits the queued entries unless another caller is already doing
+// so, in which case that caller submits them too.
+func (r *ioURing) flush() {
+	if r.submitters.Add(1) > 1 {
+		return
+	}
+	for {
+		served := r.submitters.Load()
+		for {
+			queued := atomic.LoadUint32(r.sqTail) - atomic.LoadUint32(r.sqHead)
+			if queued == 0 {
+				break
+			}
+			if err := r.enter(queued); err != nil {
+				// Keep the submitter slot so nothing is submitted again
+				r.fail(fmt.Errorf("io_uring_enter: %w", err))
+				return
+			}
+		}
+		// Receives and sends on ready sockets complete within the enter,
+		// their callers need not wait for the reaper to wake up
+		r.complete()
+		if r.submitters.Add(-served) == 0 {
+			return
+		}
+	}
+}
+
+// fail gives up on submitting after io_uring_enter broke. Operations the
+// kernel never took are cancelled; the rest still complete normally.
+func (r *ioURing) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+
+	r.pmu.Lock()
+	for head := atomic.LoadUint32(r.sqHead); head != *r.sqTail; head++ {
+		id := r.sqes[r.sqArray[head&r.sqMask]].userData
+		if ch, ok := r.pending[id]; ok {
+			ch <- -int32(unix.ECANCELED)
+			delete(r.pending, id)
+		}
+	}
+	r.pmu.Unlock()
+	close(r.broken)
+}
+
+// complete hands every posted completion to its caller.
+func (r *ioURing) complete() {
+	r.cqMu.Lock()
+	defer r.cqMu.Unlock()
+
+	head := *r.cqHead
+	tail := atomic.LoadUint32(r.cqTail)
+	for ; head != tail; head++ {
+		cqe := r.cqes[head&r.cqMask]
+
+		r.pmu.Lock()
+		ch, ok := r.pending[cqe.userData]
+		delete(r.pending, cqe.userData)
+		r.pmu.Unlock()
+
+		if ok {
+			ch <- cqe.res
+		}
+	}
+	atomic.StoreUint32(r.cqHead, head)
+}
+
+// reap hands out completions whenever the eventfd fires, until Close
+// closes it.
+func (r *ioURing) reap() {
+	defer close(r.done)
+
+	var count [8]byte
+	for {
+		r.complete()
+		if _, err := r.events.Read(count[:]); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops the reaper and releases the ring. Operations still in flight
+// are cancelled by the kernel when the ring fd is closed, and their callers
+// get errUringAbandoned.
+func (r *ioURing) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.mu.Unlock()
+
+	_ = r.events.Close()
+	<-r.done
+
+	// Take the submitter slot for good, so no one touches the rings after
+	// they are unmapped
+	for !r.submitters.CompareAndSwap(0, 1) {
+		select {
+		case <-r.broken:
+			// The failed submitter holds it already
+		default:
+			runtime.Gosched()
+			continue
+		}
+		break
+	}
+
+	err := unix.Close(r.fd)
+
+	r.pmu.Lock()
+	for id, ch := range r.pending {
+		ch <- uringAbandoned
+		delete(r.pending, id)
+	}
+	r.pmu.Unlock()
+
+	r.unmap()
+	return err
+}
+
+func (r *ioURing) poll(fd int, events uint32) error {
+	res, err := r.submit(func(sqe *uringSQE) {
+		sqe.opcode = uringOpPollAdd
+		sqe.fd = int32(fd)
+		sqe.opFlags = events
+	})
+	if err != nil {
+		return err
+	}
+	if res < 0 {
+		return syscall.Errno(-res)
+	}
+	return nil
+}
+
+func (r *ioURing) accept(fd int) (int, error) {
+	for {
+		res, err := r.submit(func(sqe *uringSQE) {
+			sqe.opcode = uringOpAccept
+			sqe.fd = int32(fd)
+			sqe.opFlags = unix.SOCK_NONBLOCK | unix.SOCK_CLOEXEC
+		})
+		if err != nil {
+			return -1, err
+		}
+		if res == -int32(unix.EAGAIN) {
+			if err := r.poll(fd, unix.POLLIN); err != nil {
+				return -1, err
+			}
+			continue
+		}
+		if res < 0 {
+			return -1, syscall.Errno(-res)
+		}
+		return int(res), nil
+	}
+}
+
+func (r *ioURing) recv(fd int, p []byte) (int, error) {
+	for {
+		res, err := r.submit(func(sqe *uringSQE) {
+			sqe.opcode = uringOpRecv
+			sqe.fd = int32(fd)
+			sqe.addr = uint64(uintptr(unsafe.Pointer(&p[0])))
+			sqe.len = uint32(len(p))
+		})
+		runtime.KeepAlive(p)
+		if err != nil {
+			return 0, err
+		}
+		if res == -int32(unix.EAGAIN) {
+			if err := r.poll(fd, unix.POLLIN); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if res < 0 {
+			return 0, syscall.Errno(-res)
+		}
+		return int(res), nil
+	}
+}
+
+func (r *ioURing) send(fd int, p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		res, err := r.submit(func(sqe *uringSQE) {
+			sqe.opcode = uringOpSend
+			sqe.fd = int32(fd)
+			sqe.addr = uint64(uintptr(unsafe.Pointer(&chunk[0])))
+			sqe.len = uint32(len(chunk))
+			sqe.opFlags = unix.MSG_NOSIGNAL
+		})
+		runtime.KeepAlive(chunk)
+		if err != nil {
+			return written, err
+		}
+		if res == -int32(unix.EAGAIN) {
+			if err := r.poll(fd, unix.POLLOUT); err != nil {
+				return written, err
+			}
+			continue
+		}
+		if res < 0 {
+			return written, syscall.Errno(-res)
+		}
+		written += int(res)
+	}
+	return written, nil
+}
+
+// sysFD returns the socket descriptor behind a conn or listener. The
+// descriptor is only valid while the owner stays open.
+func sysFD(v any) (int, bool) {
+	sc, ok := v.(syscall.Conn)
+	if !ok {
+		return -1, false
+	}
+
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return -1, false
+	}
+
+	fd := -1
+	if err := raw.Control(func(s uintptr) { fd = int(s) }); err != nil {
+		return -1, false
+	}
+	return fd, fd >= 0
+}
+
+// uringListener accepts connections through the ring instead of the Go
+// netpoller. Accepted sockets are handed back as regular net.Conns.
+type uringListener struct {
+	*net.TCPListener
+	ring   *ioURing
+	fd     int
+	closed atomic.Bool
+}
+
+func (l *uringListener) Accept() (net.Conn, error) {
+	if l.closed.Load() {
+		return nil, net.ErrClosed
+	}
+
+	fd, err := l.ring.accept(l.fd)
+	if err != nil {
+		if l.closed.Load() {
+			return nil, net.ErrClosed
+		}
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Addr: l.Addr(), Err: err}
+	}
+
+	f := os.NewFile(uintptr(fd), "")
+	conn, err := net.FileConn(f)
+	_ = f.Close()
+	return conn, err
+}
+
+func (l *uringListener) Close() error {
+	l.closed.Store(true)
+	// A pending IORING_OP_ACCEPT holds its own file reference, so closing
+	// alone would leave it parked. Shutting the socket down wakes it up.
+	_ = unix.Shutdown(l.fd, unix.SHUT_RDWR)
+	return l.TCPListener.Close()
+}
+
+// uringForwarder copies bytes with RECV/SEND submissions on the shared ring.
+// Connections without a raw socket (TLS, wrapped conns) use the stream path.
+type uringForwarder struct {
+	ring *ioURing
+}
+
+func (f uringForwarder) forward(dst, src net.Conn, onData func(n int64)) (int64, error) {
+	sfd, ok := sysFD(src)
+	if !ok {
+		return streamForwarder{}.forward(dst, src, onData)
+	}
+	dfd, ok := sysFD(dst)
+	if !ok {
+		return streamForwarder{}.forward(dst, src, onData)
+	}
+
+	bp := uringBufPool.Get().(*[]byte)
+	written, err := f.copy(dfd, sfd, *bp, onData)
+	// The kernel may still be writing into the buffer of an abandoned
+	// receive, so it is left to the GC instead of going to another copy
+	if !errors.Is(err, errUringAbandoned) {
+		uringBufPool.Put(bp)
+	}
+	return written, err
+}
+
+func (f uringForwarder) copy(dfd, sfd int, buf []byte, onData func(n int64)) (int64, error) {
+	var written int64
+	for {
+		n, err := f.ring.recv(sfd, buf)
+		if err != nil {
+			f.abort(sfd, dfd)
+			return written, err
+		}
+		if n == 0 {
+			return written, nil
+		}
+		onData(int64(n))
+
+		m, err := f.ring.send(dfd, buf[:n])
+		written += int64(m)
+		if err != nil {
+			f.abort(sfd, dfd)
+			return written, err
+		}
+	}
+}
+
+// abort wakes any in-flight operation on either socket. Closing the conns is
+// not enough because the ring holds its own reference to the files.
+func (f uringForwarder) abort(fds ...int) {
+	for _, fd := range fds {
+		_ = unix.Shutdown(fd, unix.SHUT_RDWR)
+	}
+}
+
+func (f uringForwarder) interrupt(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now())
+	if fd, ok := sysFD(conn); ok {
+		f.abort(fd)
+	}
+}
+
+func useIOUring(listener net.Listener) (net.Listener, forwarder, io.Closer, error) {
+	tcp, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil, nil, nil, errors.New("io_uring requires a TCP listener")
+	}
+
+	ring, err := newIOURing(uringEntries)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fd, ok := sysFD(tcp)
+	if !ok {
+		_ = ring.Close()
+		return nil, nil, nil, errors.New("failed to get listener descriptor")
+	}
+
+	return &uringListener{TCPListener: tcp, ring: ring, fd: fd}, uringForwarder{ring: ring}, ring, nil
+}
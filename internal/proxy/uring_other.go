@@ -0,0 +1,13 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+func useIOUring(_ net.Listener) (net.Listener, forwarder, io.Closer, error) {
+	return nil, nil, nil, errors.New("io_uring is only supported on linux")
+}
@@ -0,0 +1,270 @@
+//go:build linux
+
+package proxy
+
+import (
+	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
+	"LoadBalancer/internal/config"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startIOURingProxy runs a proxy with use_iouring in front of backendAddr,
+// skipping the test where the kernel has no io_uring.
+func startIOURingProxy(t *testing.T, backendAddr string, timeout config.TimeoutCfg) *Proxy {
+	t.Helper()
+
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend(backendAddr, 1)
+
+	p, err := NewProxy("127.0.0.1:0", balancer.NewRoundRobinBalancer(pool), Options{IOUring: true, Timeout: timeout})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	if p.ring == nil {
+		_ = p.listener.Close()
+		t.Skip("io_uring unavailable")
+	}
+	go p.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = p.Stop(ctx)
+	})
+	return p
+}
+
+func TestIOURingProxyEcho(t *testing.T) {
+	ln := echoServer(t)
+	defer ln.Close()
+	p := startIOURingProxy(t, ln.Addr().String(), config.TimeoutCfg{ConnectTimeout: 1})
+
+	// Concurrent clients share the ring, so their submissions get batched
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			client, err := net.Dial("tcp", p.listener.Addr().String())
+			if err != nil {
+				t.Errorf("Failed to dial: %v", err)
+				return
+			}
+			defer client.Close()
+
+			payload := make([]byte, 1<<20)
+			_, _ = rand.Read(payload)
+			go func() { _, _ = client.Write(payload) }()
+
+			echoed := make([]byte, len(payload))
+			if _, err := io.ReadFull(client, echoed); err != nil {
+				t.Errorf("Failed to read echo: %v", err)
+				return
+			}
+			if !bytes.Equal(echoed, payload) {
+				t.Error("Echoed payload differs from what was sent")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestIOURingProxyHalfClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Backend answers only once the client is done sending
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		request, _ := io.ReadAll(c)
+		_, _ = c.Write(append([]byte("got "), request...))
+	}()
+
+	p := startIOURingProxy(t, ln.Addr().String(), config.TimeoutCfg{ConnectTimeout: 1})
+
+	client, err := net.Dial("tcp", p.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite failed: %v", err)
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if string(reply) != "got hello" {
+		t.Errorf("Expected %q, got %q", "got hello", reply)
+	}
+}
+
+func TestIOURingProxyIdle(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Backend that accepts and then stays silent
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_, _ = io.Copy(io.Discard, c)
+	}()
+
+	p := startIOURingProxy(t, ln.Addr().String(), config.TimeoutCfg{ConnectTimeout: 1, ClientIdleSec: 1, BackendIdleSec: 1})
+
+	client, err := net.Dial("tcp", p.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	// The proxy's receives are parked in the ring, the idle limit has to
+	// interrupt them
+	start := time.Now()
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = client.Read(make([]byte, 1))
+	if err == nil {
+		t.Fatal("Expected the idle connection to be closed")
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		t.Fatal("Idle limit did not close the connection")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Idle timeout took too long: %s", elapsed)
+	}
+}
+
+func TestIOURingCloseCancelsInFlight(t *testing.T) {
+	ring, err := newIOURing(uringEntries)
+	if err != nil {
+		t.Skipf("io_uring unavailable: %v", err)
+	}
+
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+	fd, _ := sysFD(server)
+
+	// A receive nothing will ever complete
+	done := make(chan error, 1)
+	go func() {
+		_, err := ring.recv(fd, make([]byte, 16))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := ring.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, errUringAbandoned) {
+			t.Errorf("Expected the in-flight receive to be abandoned, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("In-flight receive was not cancelled by Close")
+	}
+
+	if _, err := ring.recv(fd, make([]byte, 16)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestIOURingForwardAbandoned(t *testing.T) {
+	ring, err := newIOURing(uringEntries)
+	if err != nil {
+		t.Skipf("io_uring unavailable: %v", err)
+	}
+
+	client, server := tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	// A forward parked in a receive when the ring goes away keeps its
+	// buffer out of the pool
+	done := make(chan error, 1)
+	go func() {
+		_, err := uringForwarder{ring: ring}.forward(client, server, func(int64) {})
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := ring.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, errUringAbandoned) {
+			t.Errorf("Expected the forward to report the abandoned receive, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Forward was not ended by Close")
+	}
+}
+
+func TestIOURingProxyStopTimeout(t *testing.T) {
+	ln := echoServer(t)
+	defer ln.Close()
+	p := startIOURingProxy(t, ln.Addr().String(), config.TimeoutCfg{ConnectTimeout: 1})
+
+	// An open connection keeps Stop from draining in time
+	client, err := net.Dial("tcp", p.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := io.ReadFull(client, make([]byte, 5)); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.Stop(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	ring := p.ring.(*ioURing)
+	ring.mu.Lock()
+	closed := ring.closed
+	ring.mu.Unlock()
+	if !closed {
+		t.Error("Expected the ring to be closed when Stop times out")
+	}
+	select {
+	case <-ring.done:
+	case <-time.After(time.Second):
+		t.Error("Expected the reaper to stop")
+	}
+}
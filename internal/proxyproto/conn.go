@@ -0,0 +1,57 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Conn is a connection whose addresses were announced by a PROXY header.
+// Reads and writes go straight to the wrapped conn.
+type Conn struct {
+	net.Conn
+	header *Header
+}
+
+func NewConn(conn net.Conn, header *Header) *Conn {
+	return &Conn{
+		Conn:   conn,
+		header: header,
+	}
+}
+
+func (c *Conn) Header() *Header {
+	return c.header
+}
+
+// RemoteAddr returns the original client address, or the peer address for
+// LOCAL/UNKNOWN headers.
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.header.Src != nil {
+		return c.header.Src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	if c.header.Dst != nil {
+		return c.header.Dst
+	}
+	return c.Conn.LocalAddr()
+}
+
+// CloseWrite half-closes the wrapped conn when it supports it.
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// SyscallConn exposes the wrapped socket so zero-copy paths keep working.
+func (c *Conn) SyscallConn() (syscall.RawConn, error) {
+	if sc, ok := c.Conn.(syscall.Conn); ok {
+		return sc.SyscallConn()
+	}
+	return nil, errors.New("proxyproto: wrapped conn has no raw socket")
+}
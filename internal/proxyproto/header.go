@@ -0,0 +1,187 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Versions accepted in configuration. None explicitly disables the header,
+// which lets a backend opt out of a globally enabled setting.
+const (
+	None = "none"
+	V1   = "v1"
+	V2   = "v2"
+)
+
+// TLV types defined by the PROXY protocol v2 spec
+const (
+	TypeALPN      byte = 0x01
+	TypeAuthority byte = 0x02
+	TypeCRC32C    byte = 0x03
+	TypeNoop      byte = 0x04
+	TypeUniqueID  byte = 0x05
+	TypeSSL       byte = 0x20
+	TypeNetNS     byte = 0x30
+
+	// Sub-TLVs carried inside a TypeSSL value
+	SubtypeSSLVersion byte = 0x21
+	SubtypeSSLCN      byte = 0x22
+	SubtypeSSLCipher  byte = 0x23
+	SubtypeSSLSigAlg  byte = 0x24
+	SubtypeSSLKeyAlg  byte = 0x25
+)
+
+var v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	v2VersionLocal = 0x20
+	v2VersionProxy = 0x21
+
+	v2FamUnspec = 0x00
+	v2FamTCP4   = 0x11
+	v2FamUDP4   = 0x12
+	v2FamTCP6   = 0x21
+	v2FamUDP6   = 0x22
+)
+
+// TLV is a type-length-value extension appended to a v2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ValidVersion reports whether v can be used as a send_proxy setting.
+func ValidVersion(v string) bool {
+	switch v {
+	case "", None, V1, V2:
+		return true
+	}
+	return false
+}
+
+// WriteHeader writes a PROXY protocol header announcing a connection from
+// src to dst. TLVs are only encoded by v2 and are ignored for v1.
+func WriteHeader(w io.Writer, version string, src, dst net.Addr, tlvs ...TLV) error {
+	var header []byte
+	var err error
+
+	switch version {
+	case V1:
+		header = encodeV1(src, dst)
+	case V2:
+		header, err = encodeV2(src, dst, tlvs)
+	default:
+		return fmt.Errorf("unsupported PROXY protocol version %q", version)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(header)
+	return err
+}
+
+// endpoints extracts IPs and ports, mapping both to the same family. ok is
+// false when the addresses cannot be described (pipes, unix sockets...).
+func endpoints(src, dst net.Addr) (srcIP, dstIP net.IP, srcPort, dstPort int, udp, ok bool) {
+	switch s := src.(type) {
+	case *net.TCPAddr:
+		d, isTCP := dst.(*net.TCPAddr)
+		if !isTCP {
+			return nil, nil, 0, 0, false, false
+		}
+		srcIP, dstIP, srcPort, dstPort = s.IP, d.IP, s.Port, d.Port
+	case *net.UDPAddr:
+		d, isUDP := dst.(*net.UDPAddr)
+		if !isUDP {
+			return nil, nil, 0, 0, false, false
+		}
+		srcIP, dstIP, srcPort, dstPort, udp = s.IP, d.IP, s.Port, d.Port, true
+	default:
+		return nil, nil, 0, 0, false, false
+	}
+
+	// Mixed families are announced as IPv6 with IPv4-mapped addresses
+	if srcIP.To4() != nil && dstIP.To4() != nil {
+		srcIP, dstIP = srcIP.To4(), dstIP.To4()
+	} else {
+		srcIP, dstIP = srcIP.To16(), dstIP.To16()
+	}
+	if srcIP == nil || dstIP == nil {
+		return nil, nil, 0, 0, false, false
+	}
+	return srcIP, dstIP, srcPort, dstPort, udp, true
+}
+
+func encodeV1(src, dst net.Addr) []byte {
+	srcIP, dstIP, srcPort, dstPort, udp, ok := endpoints(src, dst)
+	// v1 has no way to describe datagrams
+	if !ok || udp {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	proto := "TCP4"
+	if len(srcIP) == net.IPv6len {
+		proto = "TCP6"
+	}
+	return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, srcPort, dstPort)
+}
+
+func encodeV2(src, dst net.Addr, tlvs []TLV) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(v2Signature)
+
+	srcIP, dstIP, srcPort, dstPort, udp, ok := endpoints(src, dst)
+
+	var payload []byte
+	switch {
+	case !ok:
+		// LOCAL command: the receiver keeps using the real connection addresses
+		buf.WriteByte(v2VersionLocal)
+		buf.WriteByte(v2FamUnspec)
+	case len(srcIP) == net.IPv4len:
+		fam := byte(v2FamTCP4)
+		if udp {
+			fam = v2FamUDP4
+		}
+		buf.WriteByte(v2VersionProxy)
+		buf.WriteByte(fam)
+		payload = appendAddrs(payload, srcIP, dstIP, srcPort, dstPort)
+	default:
+		fam := byte(v2FamTCP6)
+		if udp {
+			fam = v2FamUDP6
+		}
+		buf.WriteByte(v2VersionProxy)
+		buf.WriteByte(fam)
+		payload = appendAddrs(payload, srcIP, dstIP, srcPort, dstPort)
+	}
+
+	for _, tlv := range tlvs {
+		if len(tlv.Value) > 0xFFFF {
+			return nil, fmt.Errorf("TLV 0x%02x too large", tlv.Type)
+		}
+		payload = append(payload, tlv.Type)
+		payload = binary.BigEndian.AppendUint16(payload, uint16(len(tlv.Value)))
+		payload = append(payload, tlv.Value...)
+	}
+
+	if len(payload) > 0xFFFF {
+		return nil, errors.New("PROXY v2 header too large")
+	}
+	_ = binary.Write(&buf, binary.BigEndian, uint16(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes(), nil
+}
+
+func appendAddrs(b []byte, srcIP, dstIP net.IP, srcPort, dstPort int) []byte {
+	b = append(b, srcIP...)
+	b = append(b, dstIP...)
+	b = binary.BigEndian.AppendUint16(b, uint16(srcPort))
+	b = binary.BigEndian.AppendUint16(b, uint16(dstPort))
+	return b
+}
@@ -0,0 +1,142 @@
+package proxyproto
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestWriteHeaderV1(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst net.Addr
+		want     string
+	}{
+		{
+			name: "tcp4",
+			src:  &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 51000},
+			dst:  &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8080},
+			want: "PROXY TCP4 192.168.1.10 10.0.0.1 51000 8080\r\n",
+		},
+		{
+			name: "tcp6",
+			src:  &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51000},
+			dst:  &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+			want: "PROXY TCP6 2001:db8::1 2001:db8::2 51000 443\r\n",
+		},
+		{
+			name: "unknown",
+			src:  &net.UnixAddr{Name: "/tmp/a", Net: "unix"},
+			dst:  &net.UnixAddr{Name: "/tmp/b", Net: "unix"},
+			want: "PROXY UNKNOWN\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteHeader(&buf, V1, tt.src, tt.dst); err != nil {
+				t.Fatalf("WriteHeader failed: %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestWriteHeaderV2(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 51000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8080}
+
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, V2, src, dst, TLV{Type: TypeAuthority, Value: []byte("example.com")}); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	want := append([]byte{}, v2Signature...)
+	want = append(want, 0x21, 0x11, 0x00, 12+3+11)
+	want = append(want, 192, 168, 1, 10, 10, 0, 0, 1, 0xC7, 0x38, 0x1F, 0x90)
+	want = append(want, TypeAuthority, 0x00, 11)
+	want = append(want, "example.com"...)
+
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Expected %x, got %x", want, buf.Bytes())
+	}
+}
+
+func TestWriteHeaderV2IPv6AndLocal(t *testing.T) {
+	// Mixed families are promoted to IPv6
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 1}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2}
+
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf, V2, src, dst); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+	header := buf.Bytes()
+	if header[13] != v2FamTCP6 {
+		t.Errorf("Expected TCP6 family, got 0x%02x", header[13])
+	}
+	if len(header) != 16+36 {
+		t.Errorf("Expected 52 byte header, got %d", len(header))
+	}
+
+	// Addresses that cannot be described fall back to LOCAL
+	buf.Reset()
+	pipeA, pipeB := net.Pipe()
+	defer pipeA.Close()
+	defer pipeB.Close()
+	if err := WriteHeader(&buf, V2, pipeA.RemoteAddr(), pipeA.LocalAddr()); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+	header = buf.Bytes()
+	if header[12] != v2VersionLocal || header[13] != v2FamUnspec || len(header) != 16 {
+		t.Errorf("Expected LOCAL header, got %x", header)
+	}
+}
+
+func TestWriteHeaderInvalidVersion(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteHeader(&buf, "v3", &net.TCPAddr{}, &net.TCPAddr{})
+	if err == nil {
+		t.Error("Expected error for unsupported version")
+	}
+}
+
+func TestTLSTLVs(t *testing.T) {
+	tlvs := TLSTLVs(tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		ServerName:         "example.com",
+		NegotiatedProtocol: "h2",
+	})
+
+	if len(tlvs) != 3 {
+		t.Fatalf("Expected 3 TLVs, got %d", len(tlvs))
+	}
+	if tlvs[0].Type != TypeAuthority || string(tlvs[0].Value) != "example.com" {
+		t.Errorf("Expected authority TLV, got %+v", tlvs[0])
+	}
+	if tlvs[1].Type != TypeALPN || string(tlvs[1].Value) != "h2" {
+		t.Errorf("Expected ALPN TLV, got %+v", tlvs[1])
+	}
+
+	ssl := tlvs[2]
+	if ssl.Type != TypeSSL {
+		t.Fatalf("Expected SSL TLV, got type 0x%02x", ssl.Type)
+	}
+	// client flags, then a non-zero verify since no client cert was sent
+	if ssl.Value[0] != clientSSL || !bytes.Equal(ssl.Value[1:5], []byte{0, 0, 0, 1}) {
+		t.Errorf("Unexpected SSL TLV prefix % x", ssl.Value[:5])
+	}
+
+	subs, err := parseTLVs(ssl.Value[5:])
+	if err != nil {
+		t.Fatalf("Failed to parse SSL sub-TLVs: %v", err)
+	}
+	if len(subs) != 2 || string(subs[0].Value) != "TLSv1.3" || string(subs[1].Value) != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("Unexpected SSL sub-TLVs %+v", subs)
+	}
+}
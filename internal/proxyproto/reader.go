@@ -0,0 +1,179 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Longest v1 line allowed by the spec, CRLF included
+const v1MaxLength = 107
+
+var (
+	ErrNoHeader      = errors.New("proxyproto: connection did not start with a PROXY header")
+	ErrInvalidHeader = errors.New("proxyproto: malformed PROXY header")
+)
+
+// Header is a parsed PROXY protocol header. Src and Dst are nil for LOCAL
+// (v2) and UNKNOWN (v1) headers, which describe the connection itself.
+type Header struct {
+	Version string
+	Src     net.Addr
+	Dst     net.Addr
+	TLVs    []TLV
+}
+
+// ReadHeader consumes exactly one PROXY header from r and nothing more, so
+// the rest of the stream can be read straight from the underlying conn.
+func ReadHeader(r io.Reader) (*Header, error) {
+	// Both versions are at least as long as the v2 signature
+	prefix := make([]byte, len(v2Signature))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(prefix, v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(prefix, []byte("PROXY ")):
+		return readV1(r, prefix)
+	default:
+		return nil, ErrNoHeader
+	}
+}
+
+func readV1(r io.Reader, prefix []byte) (*Header, error) {
+	line := append(make([]byte, 0, v1MaxLength), prefix...)
+
+	// Read byte by byte so nothing past the CRLF is consumed
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= v1MaxLength {
+			return nil, ErrInvalidHeader
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if len(fields) < 2 {
+		return nil, ErrInvalidHeader
+	}
+
+	h := &Header{Version: V1}
+	switch fields[1] {
+	case "UNKNOWN":
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, ErrInvalidHeader
+	}
+	if len(fields) != 6 {
+		return nil, ErrInvalidHeader
+	}
+
+	srcIP, dstIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if srcIP == nil || dstIP == nil || err1 != nil || err2 != nil {
+		return nil, ErrInvalidHeader
+	}
+	if (fields[1] == "TCP4") != (srcIP.To4() != nil) {
+		return nil, ErrInvalidHeader
+	}
+
+	h.Src = &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+	h.Dst = &net.TCPAddr{IP: dstIP, Port: int(dstPort)}
+	return h, nil
+}
+
+func readV2(r io.Reader) (*Header, error) {
+	var fixed [4]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+
+	verCmd, fam := fixed[0], fixed[1]
+	length := int(binary.BigEndian.Uint16(fixed[2:]))
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if verCmd>>4 != 0x2 {
+		return nil, ErrInvalidHeader
+	}
+
+	h := &Header{Version: V2}
+	switch verCmd {
+	case v2VersionLocal:
+		// Health checks from the upstream balancer itself, addresses are ignored
+		return h, nil
+	case v2VersionProxy:
+	default:
+		return nil, ErrInvalidHeader
+	}
+
+	var addrLen int
+	switch fam {
+	case v2FamTCP4, v2FamUDP4:
+		addrLen = 12
+	case v2FamTCP6, v2FamUDP6:
+		addrLen = 36
+	case v2FamUnspec:
+		addrLen = 0
+	default:
+		// AF_UNIX and friends carry no address we can use
+		return h, nil
+	}
+	if len(payload) < addrLen {
+		return nil, ErrInvalidHeader
+	}
+
+	if addrLen > 0 {
+		ipLen := (addrLen - 4) / 2
+		srcIP := net.IP(bytes.Clone(payload[:ipLen]))
+		dstIP := net.IP(bytes.Clone(payload[ipLen : 2*ipLen]))
+		srcPort := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+		dstPort := int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+
+		if fam == v2FamUDP4 || fam == v2FamUDP6 {
+			h.Src = &net.UDPAddr{IP: srcIP, Port: srcPort}
+			h.Dst = &net.UDPAddr{IP: dstIP, Port: dstPort}
+		} else {
+			h.Src = &net.TCPAddr{IP: srcIP, Port: srcPort}
+			h.Dst = &net.TCPAddr{IP: dstIP, Port: dstPort}
+		}
+	}
+
+	tlvs, err := parseTLVs(payload[addrLen:])
+	if err != nil {
+		return nil, err
+	}
+	h.TLVs = tlvs
+	return h, nil
+}
+
+func parseTLVs(b []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, fmt.Errorf("%w: truncated TLV", ErrInvalidHeader)
+		}
+		n := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+n {
+			return nil, fmt.Errorf("%w: truncated TLV", ErrInvalidHeader)
+		}
+		tlvs = append(tlvs, TLV{Type: b[0], Value: bytes.Clone(b[3 : 3+n])})
+		b = b[3+n:]
+	}
+	return tlvs, nil
+}
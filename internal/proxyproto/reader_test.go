@@ -0,0 +1,104 @@
+package proxyproto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestReadHeaderRoundTrip(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7").To4(), Port: 40000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1").To4(), Port: 443}
+
+	for _, version := range []string{V1, V2} {
+		t.Run(version, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteHeader(&buf, version, src, dst); err != nil {
+				t.Fatalf("WriteHeader failed: %v", err)
+			}
+			buf.WriteString("payload")
+
+			h, err := ReadHeader(&buf)
+			if err != nil {
+				t.Fatalf("ReadHeader failed: %v", err)
+			}
+			if h.Version != version {
+				t.Errorf("Expected version %s, got %s", version, h.Version)
+			}
+			if h.Src.String() != src.String() || h.Dst.String() != dst.String() {
+				t.Errorf("Expected %s -> %s, got %s -> %s", src, dst, h.Src, h.Dst)
+			}
+
+			// Nothing past the header may be consumed
+			rest, _ := io.ReadAll(&buf)
+			if string(rest) != "payload" {
+				t.Errorf("Expected payload to remain, got %q", rest)
+			}
+		})
+	}
+}
+
+func TestReadHeaderV2TLVs(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443}
+
+	var buf bytes.Buffer
+	tlv := TLV{Type: TypeAuthority, Value: []byte("example.com")}
+	if err := WriteHeader(&buf, V2, src, dst, tlv); err != nil {
+		t.Fatalf("WriteHeader failed: %v", err)
+	}
+
+	h, err := ReadHeader(&buf)
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if h.Src.String() != src.String() {
+		t.Errorf("Expected src %s, got %s", src, h.Src)
+	}
+	if len(h.TLVs) != 1 || h.TLVs[0].Type != TypeAuthority || string(h.TLVs[0].Value) != "example.com" {
+		t.Errorf("Unexpected TLVs: %+v", h.TLVs)
+	}
+}
+
+func TestReadHeaderLocalAndUnknown(t *testing.T) {
+	h, err := ReadHeader(bytes.NewReader([]byte("PROXY UNKNOWN\r\n")))
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if h.Src != nil || h.Dst != nil {
+		t.Error("UNKNOWN header should carry no addresses")
+	}
+
+	local := append(append([]byte{}, v2Signature...), v2VersionLocal, v2FamUnspec, 0, 0)
+	h, err = ReadHeader(bytes.NewReader(local))
+	if err != nil {
+		t.Fatalf("ReadHeader failed: %v", err)
+	}
+	if h.Src != nil || h.Dst != nil {
+		t.Error("LOCAL header should carry no addresses")
+	}
+}
+
+func TestReadHeaderInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no header":       "GET / HTTP/1.1\r\n\r\n",
+		"bad family":      "PROXY TCP5 1.2.3.4 5.6.7.8 1 2\r\n",
+		"family mismatch": "PROXY TCP6 1.2.3.4 5.6.7.8 1 2\r\n",
+		"bad port":        "PROXY TCP4 1.2.3.4 5.6.7.8 1 99999\r\n",
+		"too long":        "PROXY TCP4 " + string(bytes.Repeat([]byte("1"), 200)),
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadHeader(bytes.NewReader([]byte(input)))
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if name == "no header" && !errors.Is(err, ErrNoHeader) {
+				t.Errorf("Expected ErrNoHeader, got %v", err)
+			}
+		})
+	}
+}
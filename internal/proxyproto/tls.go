@@ -0,0 +1,58 @@
+package proxyproto
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+)
+
+// Flags in the first byte of a TypeSSL value
+const (
+	clientSSL      = 0x01
+	clientCertConn = 0x02
+)
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLSv1.0",
+	tls.VersionTLS11: "TLSv1.1",
+	tls.VersionTLS12: "TLSv1.2",
+	tls.VersionTLS13: "TLSv1.3",
+}
+
+// TLSTLVs describes a terminated TLS session for the backend: the SNI as
+// the authority, the negotiated ALPN protocol and an SSL TLV carrying the
+// protocol version and cipher.
+func TLSTLVs(state tls.ConnectionState) []TLV {
+	var tlvs []TLV
+	if state.ServerName != "" {
+		tlvs = append(tlvs, TLV{Type: TypeAuthority, Value: []byte(state.ServerName)})
+	}
+	if state.NegotiatedProtocol != "" {
+		tlvs = append(tlvs, TLV{Type: TypeALPN, Value: []byte(state.NegotiatedProtocol)})
+	}
+
+	client := byte(clientSSL)
+	// verify is zero only for a client certificate that was checked
+	verify := uint32(1)
+	if len(state.VerifiedChains) > 0 {
+		client |= clientCertConn
+		verify = 0
+	}
+
+	ssl := []byte{client}
+	ssl = binary.BigEndian.AppendUint32(ssl, verify)
+	if name, ok := tlsVersionNames[state.Version]; ok {
+		ssl = appendSubTLV(ssl, SubtypeSSLVersion, []byte(name))
+	}
+	ssl = appendSubTLV(ssl, SubtypeSSLCipher, []byte(tls.CipherSuiteName(state.CipherSuite)))
+	if len(state.VerifiedChains) > 0 {
+		ssl = appendSubTLV(ssl, SubtypeSSLCN, []byte(state.PeerCertificates[0].Subject.CommonName))
+	}
+
+	return append(tlvs, TLV{Type: TypeSSL, Value: ssl})
+}
+
+func appendSubTLV(b []byte, typ byte, value []byte) []byte {
+	b = append(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
@@ -0,0 +1,199 @@
+package tlsconfig
+
+import (
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/logging"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Store holds the configured certificates and picks one per handshake
+// by SNI. It is swapped as a whole on reload, so handshakes already in
+// flight and established connections keep the certificate they started with.
+type Store struct {
+	files []config.CertCfg
+
+	mu     sync.RWMutex
+	certs  []*tls.Certificate
+	names  map[string]*tls.Certificate // lower-cased DNS names, wildcards as "*.example.com"
+	stamps []time.Time                 // mod times of the files the certificates were loaded from
+}
+
+func NewStore(files []config.CertCfg) (*Store, error) {
+	s := &Store{files: files}
+	if err := s.load(s.stat()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stat returns the mod time of every certificate and key file. Missing
+// files report the zero time, which shows up as a change once they return.
+func (s *Store) stat() []time.Time {
+	stamps := make([]time.Time, 0, 2*len(s.files))
+	for _, f := range s.files {
+		for _, path := range []string{f.CertFile, f.KeyFile} {
+			var mod time.Time
+			if info, err := os.Stat(path); err == nil {
+				mod = info.ModTime()
+			}
+			stamps = append(stamps, mod)
+		}
+	}
+	return stamps
+}
+
+func (s *Store) load(stamps []time.Time) error {
+	certs := make([]*tls.Certificate, 0, len(s.files))
+	names := make(map[string]*tls.Certificate)
+
+	for _, f := range s.files {
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %s: %w", f.CertFile, err)
+		}
+		if cert.Leaf == nil {
+			if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return fmt.Errorf("failed to parse certificate %s: %w", f.CertFile, err)
+			}
+		}
+
+		hosts := cert.Leaf.DNSNames
+		if len(hosts) == 0 && cert.Leaf.Subject.CommonName != "" {
+			hosts = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, host := range hosts {
+			host = strings.ToLower(host)
+			// Earlier entries in the config win when names overlap
+			if _, ok := names[host]; !ok {
+				names[host] = &cert
+			}
+		}
+		certs = append(certs, &cert)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certs, s.names, s.stamps = certs, names, stamps
+	return nil
+}
+
+// Refresh reloads the certificates when any file changed on disk. A failed
+// reload keeps serving the previous set and is retried on the next call.
+func (s *Store) Refresh() (bool, error) {
+	stamps := s.stat()
+
+	s.mu.RLock()
+	changed := !slices.EqualFunc(stamps, s.stamps, time.Time.Equal)
+	s.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	if err := s.load(stamps); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := s.Refresh()
+			if err != nil {
+				logging.L().Warn("Failed to reload TLS certificates, keeping the previous ones", zap.Error(err))
+			} else if reloaded {
+				logging.L().Info("Reloaded TLS certificates")
+			}
+		}
+	}
+}
+
+// GetCertificate matches the SNI exactly, then against a wildcard for its
+// parent domain, and otherwise falls back to the first certificate.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if cert, ok := s.names[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := s.names["*"+name[i:]]; ok {
+			return cert, nil
+		}
+	}
+	return s.certs[0], nil
+}
+
+// New builds a server config for cfg. Certificates are served from the
+// returned Store, which only reloads them while Watch runs.
+func New(cfg config.TLSCfg) (*tls.Config, *Store, error) {
+	minVersion, ok := versions[cfg.MinVersion]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported TLS min_version %q", cfg.MinVersion)
+	}
+
+	suites, err := cipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := NewStore(cfg.Certificates)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &tls.Config{
+		GetCertificate: store.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+	}, store, nil
+}
+
+// cipherSuites maps suite names to IDs. Only suites Go considers secure
+// are accepted; TLS 1.3 suites are not configurable and are always enabled.
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
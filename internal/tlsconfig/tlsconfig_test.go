@@ -0,0 +1,90 @@
+package tlsconfig
+
+import (
+	"LoadBalancer/internal/config"
+	"LoadBalancer/internal/tlsconfig/tlsconfigtest"
+	"crypto/tls"
+	"os"
+	"testing"
+	"time"
+)
+
+func leafName(t *testing.T, s *Store, serverName string) string {
+	t.Helper()
+
+	cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		t.Fatalf("getCertificate failed: %v", err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestCertStoreSelectsBySNI(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore([]config.CertCfg{
+		tlsconfigtest.WriteCert(t, dir, "default", "default.test"),
+		tlsconfigtest.WriteCert(t, dir, "exact", "api.example.com"),
+		tlsconfigtest.WriteCert(t, dir, "wildcard", "*.example.org"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	tests := []struct {
+		serverName string
+		want       string
+	}{
+		{"api.example.com", "api.example.com"},
+		{"API.Example.com.", "api.example.com"},
+		{"www.example.org", "*.example.org"},
+		{"a.b.example.org", "default.test"},
+		{"unknown.test", "default.test"},
+		{"", "default.test"},
+	}
+
+	for _, tt := range tests {
+		if got := leafName(t, s, tt.serverName); got != tt.want {
+			t.Errorf("SNI %q: expected certificate %s, got %s", tt.serverName, tt.want, got)
+		}
+	}
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	files := tlsconfigtest.WriteCert(t, dir, "site", "old.example.com")
+
+	s, err := NewStore([]config.CertCfg{files})
+	if err != nil {
+		t.Fatalf("Failed to load certificates: %v", err)
+	}
+
+	if reloaded, err := s.Refresh(); reloaded || err != nil {
+		t.Fatalf("Expected no reload for unchanged files, got %v, %v", reloaded, err)
+	}
+
+	// Rotate in place and push the mod time forward so the change is seen
+	// even on filesystems with coarse timestamps
+	tlsconfigtest.WriteCert(t, dir, "site", "new.example.com")
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(files.CertFile, future, future)
+	_ = os.Chtimes(files.KeyFile, future, future)
+
+	if reloaded, err := s.Refresh(); !reloaded || err != nil {
+		t.Fatalf("Expected reload, got %v, %v", reloaded, err)
+	}
+	if got := leafName(t, s, ""); got != "new.example.com" {
+		t.Errorf("Expected rotated certificate, got %s", got)
+	}
+
+	// A half-written file keeps the previous certificate in service
+	_ = os.WriteFile(files.CertFile, []byte("garbage"), 0o600)
+	later := future.Add(time.Minute)
+	_ = os.Chtimes(files.CertFile, later, later)
+
+	if _, err := s.Refresh(); err == nil {
+		t.Fatal("Expected reload of a broken certificate to fail")
+	}
+	if got := leafName(t, s, ""); got != "new.example.com" {
+		t.Errorf("Expected previous certificate to stay, got %s", got)
+	}
+}
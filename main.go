@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"LoadBalancer/internal/balancer"
 	"LoadBalancer/internal/config"
 	"LoadBalancer/internal/health"
+	"LoadBalancer/internal/httpproxy"
 	"LoadBalancer/internal/logging"
 	"LoadBalancer/internal/proxy"
 	"LoadBalancer/pkg/api"
@@ -41,55 +44,209 @@ func main() {
 
 	defer func() { _ = logging.L().Sync() }()
 
-	//Initialise backend pool
+	// App context for long-running services
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // Ensure cleanup if main exits early
+
+	pools := make([]map[string]*backend.Pool, 0, len(cfg.Frontends))
+	stickies := make([]map[string]*balancer.Sticky, 0, len(cfg.Frontends))
+	servers := make([]proxy.Server, 0, len(cfg.Frontends))
+	for _, f := range cfg.Frontends {
+		frontendPools, sticky, server := newFrontend(ctx, f)
+		pools = append(pools, frontendPools)
+		stickies = append(stickies, sticky)
+		servers = append(servers, server)
+	}
+
+	for i, server := range servers {
+		name := cfg.Frontends[i].Name
+		go func() {
+			if err := server.Start(); err != nil {
+				logging.L().Fatal("Failed to start proxy", zap.String("frontend", name), zap.Error(err))
+			}
+		}()
+	}
+
+	apiHandler := api.NewHandler(pools[0][config.DefaultPool])
+	for i, f := range cfg.Frontends {
+		apiHandler.AddFrontend(f.Name, pools[i][config.DefaultPool])
+		for name, pool := range pools[i] {
+			apiHandler.AddPool(f.Name, name, pool)
+		}
+		for _, name := range slices.Sorted(maps.Keys(stickies[i])) {
+			apiHandler.AddSticky(f.Name, name, stickies[i][name])
+		}
+	}
+	apiRouter := api.Routes(apiHandler)
+	apiServer := api.New(":8081", apiRouter)
+
+	go func() {
+		logging.L().Info("API Server Listening", zap.String("address", ":8081"))
+		if err := apiServer.Start(); err != nil && err != http.ErrServerClosed {
+			logging.L().Fatal("Failed to start API server", zap.Error(err))
+		}
+	}()
+
+	//Graceful Shutdown
+	sigC := make(chan os.Signal, 1) //Buffered channel to avoid missing signals
+	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM)
+
+	<-sigC
+	logging.L().Info("Shutting down gracefully...")
+
+	// Cancel long-running services
+	cancel()
+
+	// Shutdown context with timeout
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	for i, server := range servers {
+		if err := server.Stop(shutdownCtx); err != nil {
+			logging.L().Error("Failed to stop proxy", zap.String("frontend", cfg.Frontends[i].Name), zap.Error(err))
+		}
+	}
+
+	if err := apiServer.Stop(shutdownCtx); err != nil {
+		logging.L().Error("Failed to stop API server", zap.Error(err))
+	}
+
+	logging.L().Info("Load Balanced exited cleanly.")
+}
+
+// newFrontend builds the pools, balancers, health checks and discovery for
+// one frontend and returns its pools and sticky session tables by pool name
+// and the server listening for it.
+func newFrontend(ctx context.Context, f config.FrontendCfg) (map[string]*backend.Pool, map[string]*balancer.Sticky, proxy.Server) {
 	pool := backend.NewPool()
+	stickies := make(map[string]*balancer.Sticky)
 
-	for _, b := range cfg.Backends {
-		if _, err := pool.AddBackend(b.Address, b.Weight); err != nil {
-			logging.L().Error("Failed to add initial backend", zap.String("address", b.Address), zap.Error(err))
+	// withSticky puts a session table in front of lb when the frontend asks for one
+	withSticky := func(name string, lb balancer.Balancer, pool *backend.Pool) balancer.Balancer {
+		if !f.Sticky.Enabled {
+			return lb
 		}
+		sticky := balancer.NewStickyBalancer(lb, pool, time.Duration(f.Sticky.TTLSec)*time.Second, f.Sticky.MaxEntries)
+		stickies[name] = sticky
+		return sticky
 	}
 
-	var lb balancer.Balancer
+	slowStart := backend.SlowStart{
+		Window:     time.Duration(f.SlowStart.WindowSec) * time.Second,
+		Aggression: f.SlowStart.Aggression,
+		MinPercent: f.SlowStart.MinWeightPercent,
+	}
 
-	switch cfg.Algorithm {
-	case "round_robin":
-		lb = balancer.NewRoundRobinBalancer(pool)
-	case "least_connections":
-		lb = balancer.NewLeastConnectionsBalancer(pool)
-	case "weighted":
-		lb = balancer.NewWeightedBalancer(pool)
-	case "ip_hash":
-		lb = balancer.NewIPHashBalancer(pool)
-	default:
-		logging.L().Fatal("Invalid load balancing algorithm", zap.String("algorithm", cfg.Algorithm))
+	pool.SetSlowStart(slowStart)
+	pool.SetOverprovisioning(f.Failover.OverprovisioningFactor)
+	addBackends(pool, f.Backends)
+	lb := withSticky(config.DefaultPool, newBalancer(f.Algorithm, pool, f), pool)
+
+	checkHealth := func(pool *backend.Pool) {
+		if !*f.HealthCheck.Enabled {
+			return
+		}
+		go health.New(pool, f.HealthCheck).Start()
+	}
+	checkHealth(pool)
+
+	// Named pools for SNI and HTTP routing, each with its own balancer and health checks
+	balancers := map[string]balancer.Balancer{config.DefaultPool: lb}
+	pools := map[string]*backend.Pool{config.DefaultPool: pool}
+	for name, poolCfg := range f.Pools {
+		namedPool := backend.NewPool()
+		pools[name] = namedPool
+		namedPool.SetSlowStart(slowStart)
+		namedPool.SetOverprovisioning(f.Failover.OverprovisioningFactor)
+		addBackends(namedPool, poolCfg.Backends)
+		balancers[name] = withSticky(name, newBalancer(poolCfg.Algorithm, namedPool, f), namedPool)
+
+		checkHealth(namedPool)
 	}
 
-	hc := health.New(pool, cfg.HealthCheck)
-	go hc.Start()
+	sniRoutes := make([]proxy.SNIRoute, 0, len(f.SNIRoutes))
+	for _, route := range f.SNIRoutes {
+		sniRoutes = append(sniRoutes, proxy.SNIRoute{
+			ServerName: route.ServerName,
+			Balancer:   balancers[route.Pool],
+		})
+	}
+
+	options := proxy.Options{
+		IOUring:        f.UseIOUring,
+		Timeout:        f.Timeout,
+		ConnectRetries: f.ConnectRetries,
+		SendProxy:      f.SendProxy,
+		AcceptProxy:    f.AcceptProxy,
+		TLS:            f.TLS,
+		SNIRoutes:      sniRoutes,
+	}
+	// Failed dials count toward the health check's retries, but only the
+	// health checker can bring a backend back
+	if *f.HealthCheck.Enabled {
+		options.FailureThreshold = f.HealthCheck.Retries
+	}
+	if f.Outlier.Enabled {
+		detector := health.NewDetector(f.Outlier, slices.Collect(maps.Values(pools))...)
+		go detector.Start()
+		options.Observer = detector
+	}
 
-	pxy, err := proxy.NewProxy(
-		cfg.ListenAddress,
-		lb,
-		proxy.Options{
-			IOUring: cfg.UseIOUring,
-			Timeout: cfg.Timeout,
+	httpRoutes := make([]httpproxy.Route, 0, len(f.HTTPRoutes))
+	for _, route := range f.HTTPRoutes {
+		httpRoutes = append(httpRoutes, httpproxy.Route{
+			Host:       route.Host,
+			PathPrefix: route.PathPrefix,
+			PathRegex:  route.PathRegex,
+			Methods:    route.Methods,
+			Headers:    route.Headers,
+			Balancer:   balancers[route.Pool],
 		})
+	}
+
+	var pxy proxy.Server
+	var err error
+	switch f.Protocol {
+	case "http", "grpc":
+		pxy, err = httpproxy.NewServer(f.ListenAddress, lb, httpproxy.Options{
+			Timeout:         f.Timeout,
+			Routes:          httpRoutes,
+			TLS:             f.TLS,
+			H2C:             f.HTTP.H2C,
+			BackendProtocol: f.HTTP.BackendProtocol,
+			WebSocket:       f.HTTP.WebSocket,
+			Retry:           f.HTTP.Retry,
+			Key:             httpKey(f.Sticky),
+		})
+	case "udp":
+		pxy, err = proxy.NewUDPProxy(f.ListenAddress, lb, options)
+	default:
+		pxy, err = proxy.NewProxy(f.ListenAddress, lb, options)
+	}
 	if err != nil {
-		logging.L().Fatal("Failed to create proxy", zap.Error(err))
+		logging.L().Fatal("Failed to create proxy", zap.String("frontend", f.Name), zap.Error(err))
 	}
 
-	// App context for long-running services
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // Ensure cleanup if main exits early
+	for name, pool := range pools {
+		d := f.Discovery
+		if name != config.DefaultPool {
+			d = f.Pools[name].Discovery
+		}
+		startDiscovery(ctx, f.Name, name, d, pool)
+	}
+
+	return pools, stickies, pxy
+}
 
+// startDiscovery keeps pool in sync with the backends found by the given
+// discovery, doing nothing for static pools.
+func startDiscovery(ctx context.Context, frontend, poolName string, d config.DiscoveryCfg, pool *backend.Pool) {
 	events := make(chan discovery.Event, 128)
 
-	// Initialize discovery services
-	switch cfg.Discovery.Type {
+	switch d.Type {
 	case "docker":
-		logging.L().Info("Using Docker discovery")
-		dockerDiscover := docker.NewDockerDiscover()
+		logging.L().Info("Using Docker discovery", zap.String("frontend", frontend), zap.String("pool", poolName))
+		dockerDiscover := docker.NewDockerDiscover(d.Docker.Frontend)
 		if dockerDiscover != nil {
 			go func() {
 				if err := dockerDiscover.Run(ctx, events); err != nil {
@@ -98,10 +255,10 @@ func main() {
 			}()
 		}
 	case "kubernetes":
-		logging.L().Info("Using Kubernetes discovery")
+		logging.L().Info("Using Kubernetes discovery", zap.String("frontend", frontend), zap.String("pool", poolName))
 		k8sDiscover := kubernetes.NewKubernetesDiscover(
-			cfg.Discovery.Kubernetes.Namespace,
-			cfg.Discovery.Kubernetes.Service,
+			d.Kubernetes.Namespace,
+			d.Kubernetes.Service,
 		)
 		go func() {
 			if err := k8sDiscover.Run(ctx, events); err != nil {
@@ -109,9 +266,11 @@ func main() {
 			}
 		}()
 	case "static":
-		logging.L().Info("Using static discovery")
+		logging.L().Info("Using static discovery", zap.String("frontend", frontend), zap.String("pool", poolName))
+		return
 	default:
-		logging.L().Warn("Unknown discovery type, defaulting to static", zap.String("type", cfg.Discovery.Type))
+		logging.L().Warn("Unknown discovery type, defaulting to static", zap.String("type", d.Type))
+		return
 	}
 
 	registry := backend.NewRegistry(pool)
@@ -121,45 +280,59 @@ func main() {
 			registry.Apply(e)
 		}
 	}()
+}
 
-	go func() {
-		if err := pxy.Start(); err != nil {
-			logging.L().Fatal("Failed to start proxy", zap.Error(err))
-		}
-	}()
-
-	apiHandler := api.NewHandler(pool)
-	apiRouter := api.Routes(apiHandler)
-	apiServer := api.New(":8081", apiRouter)
+// httpKey is what http and grpc frontends balance requests on, which only
+// differs from the client IP for sticky sessions keyed by header or cookie.
+func httpKey(sticky config.StickyCfg) string {
+	if !sticky.Enabled {
+		return config.StickyClientIP
+	}
+	return sticky.Key
+}
 
-	go func() {
-		logging.L().Info("API Server Listening", zap.String("address", ":8081"))
-		if err := apiServer.Start(); err != nil && err != http.ErrServerClosed {
-			logging.L().Fatal("Failed to start API server", zap.Error(err))
+func addBackends(pool *backend.Pool, backends []config.BackendCfg) {
+	for _, b := range backends {
+		limits := backend.Limits{
+			MaxConnections:    b.CircuitBreaker.MaxConnections,
+			MaxPending:        b.CircuitBreaker.MaxPending,
+			MaxConnectsPerSec: b.CircuitBreaker.MaxConnectsPerSec,
+		}
+		opts := []backend.Option{
+			backend.WithProxyProtocol(b.SendProxy),
+			backend.WithLimits(limits),
+			backend.WithPriority(b.Priority),
+		}
+		if _, err := pool.AddBackend(b.Address, b.Weight, opts...); err != nil {
+			logging.L().Error("Failed to add initial backend", zap.String("address", b.Address), zap.Error(err))
 		}
-	}()
-
-	//Graceful Shutdown
-	sigC := make(chan os.Signal, 1) //Buffered channel to avoid missing signals
-	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM)
-
-	<-sigC
-	logging.L().Info("Shutting down gracefully...")
-
-	// Cancel long-running services
-	cancel()
-
-	// Shutdown context with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer shutdownCancel()
-
-	if err := pxy.Stop(shutdownCtx); err != nil {
-		logging.L().Error("Failed to stop proxy", zap.Error(err))
 	}
+}
 
-	if err := apiServer.Stop(shutdownCtx); err != nil {
-		logging.L().Error("Failed to stop API server", zap.Error(err))
+// newBalancer builds algorithm for pool, tuned by the settings of its
+// frontend f.
+func newBalancer(algorithm string, pool *backend.Pool, f config.FrontendCfg) balancer.Balancer {
+	switch algorithm {
+	case "round_robin":
+		return balancer.NewRoundRobinBalancer(pool)
+	case "least_connections":
+		return balancer.NewLeastConnectionsBalancer(pool)
+	case "weighted":
+		return balancer.NewWeightedBalancer(pool)
+	case "smooth_weighted":
+		return balancer.NewSmoothWeightedBalancer(pool)
+	case "ip_hash":
+		return balancer.NewIPHashBalancer(pool)
+	case "p2c":
+		return balancer.NewP2CBalancer(pool, *f.P2C.Weighted)
+	case "peak_ewma":
+		return balancer.NewPeakEWMABalancer(pool)
+	case "maglev":
+		return balancer.NewMaglevBalancer(pool)
+	case "ring_hash":
+		return balancer.NewRingHashBalancer(pool, f.RingHash.VirtualNodes, f.RingHash.Epsilon)
+	default:
+		logging.L().Fatal("Invalid load balancing algorithm", zap.String("algorithm", algorithm))
+		return nil
 	}
-
-	logging.L().Info("Load Balanced exited cleanly.")
 }
@@ -2,11 +2,13 @@ package api
 
 import (
 	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
 	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestHealthCheck(t *testing.T) {
@@ -53,7 +55,8 @@ func TestGetBackends(t *testing.T) {
 	}
 
 	// Add one
-	_, _ = pool.AddBackend("10.0.0.1:8080", 1)
+	b, _ := pool.AddBackend("10.0.0.1:8080", 1)
+	b.AddGRPCStatus(14)
 
 	resp, err = http.Get(server.URL + "/backends")
 	if err != nil {
@@ -71,6 +74,12 @@ func TestGetBackends(t *testing.T) {
 	if backends[0].Address != "10.0.0.1:8080" {
 		t.Errorf("Expected address 10.0.0.1:8080, got %s", backends[0].Address)
 	}
+	if backends[0].EffectiveWeight != 1 {
+		t.Errorf("Expected effective weight 1, got %v", backends[0].EffectiveWeight)
+	}
+	if got := backends[0].GRPCStatus; len(got) != 1 || got["UNAVAILABLE"] != 1 {
+		t.Errorf("Expected grpc_status {UNAVAILABLE: 1}, got %v", got)
+	}
 }
 
 func TestAddBackend(t *testing.T) {
@@ -110,6 +119,33 @@ func TestAddBackend(t *testing.T) {
 	if resp.StatusCode != http.StatusConflict {
 		t.Errorf("Expected status 409 for duplicate, got %d", resp.StatusCode)
 	}
+
+	// Backups are added to a lower priority tier
+	body, _ = json.Marshal(AddBackendRequest{Address: "10.0.0.3:8080", Weight: 1, Priority: 1})
+	resp, err = http.Post(server.URL+"/backends", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var added Backend
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if added.Priority != 1 {
+		t.Errorf("Expected priority 1, got %d", added.Priority)
+	}
+
+	body, _ = json.Marshal(AddBackendRequest{Address: "10.0.0.4:8080", Weight: 1, Priority: -1})
+	resp, err = http.Post(server.URL+"/backends", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a negative priority, got %d", resp.StatusCode)
+	}
 }
 
 func TestBackendByAddress(t *testing.T) {
@@ -186,3 +222,273 @@ func TestBackendByAddress(t *testing.T) {
 		t.Errorf("Expected status 404, got %d", resp.StatusCode)
 	}
 }
+
+func TestFrontendBackends(t *testing.T) {
+	web := backend.NewPool()
+	_, _ = web.AddBackend("10.0.0.4:8080", 1)
+	api := backend.NewPool()
+	_, _ = api.AddBackend("10.0.1.4:9090", 3)
+
+	h := NewHandler(web)
+	h.AddFrontend("web", web)
+	h.AddFrontend("api", api)
+	server := httptest.NewServer(Routes(h))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/frontends/api/backends")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var backends []Backend
+	if err := json.NewDecoder(resp.Body).Decode(&backends); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(backends) != 1 || backends[0].Address != "10.0.1.4:9090" {
+		t.Errorf("Expected only the api backend, got %+v", backends)
+	}
+
+	// Changes are scoped to the named frontend
+	body, _ := json.Marshal(AddBackendRequest{Address: "10.0.1.5:9090", Weight: 1})
+	resp, err = http.Post(server.URL+"/frontends/api/backends", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if !api.HasBackend("10.0.1.5:9090") || web.HasBackend("10.0.1.5:9090") {
+		t.Error("Backend was not added to the api frontend only")
+	}
+
+	resp, err = http.Get(server.URL + "/frontends/api/backends/10.0.1.4:9090")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var b Backend
+	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if b.Weight != 3 {
+		t.Errorf("Expected weight 3, got %d", b.Weight)
+	}
+
+	resp, err = http.Get(server.URL + "/frontends/missing/backends")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL + "/frontends")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var frontends []Frontend
+	if err := json.NewDecoder(resp.Body).Decode(&frontends); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(frontends) != 2 || frontends[0].Name != "web" || frontends[1].Name != "api" {
+		t.Errorf("Expected frontends web and api, got %+v", frontends)
+	}
+}
+
+func TestPoolBackends(t *testing.T) {
+	web := backend.NewPool()
+	_, _ = web.AddBackend("10.0.0.4:8080", 1)
+	static := backend.NewPool()
+	_, _ = static.AddBackend("10.0.2.4:8080", 2)
+
+	h := NewHandler(web)
+	h.AddFrontend("web", web)
+	h.AddPool("web", "default", web)
+	h.AddPool("web", "static", static)
+	server := httptest.NewServer(Routes(h))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/frontends/web/pools/static/backends")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var backends []Backend
+	if err := json.NewDecoder(resp.Body).Decode(&backends); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(backends) != 1 || backends[0].Address != "10.0.2.4:8080" {
+		t.Errorf("Expected only the static pool backend, got %+v", backends)
+	}
+
+	// Limits of a named pool's backend can be changed like any other
+	body, _ := json.Marshal(Limits{MaxConnections: 7})
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/frontends/web/pools/static/backends/10.0.2.4:8080/limits", bytes.NewReader(body))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if b, _ := static.GetBackend("10.0.2.4:8080"); b.Limits().MaxConnections != 7 {
+		t.Errorf("Expected max_connections 7, got %d", b.Limits().MaxConnections)
+	}
+
+	for _, path := range []string{"/frontends/web/pools/missing/backends", "/frontends/missing/pools/static/backends"} {
+		resp, err = http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404 for %s, got %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "/frontends")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var frontends []Frontend
+	if err := json.NewDecoder(resp.Body).Decode(&frontends); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(frontends) != 1 || len(frontends[0].Pools) != 2 || frontends[0].Pools[1].Name != "static" {
+		t.Errorf("Expected the default and static pools, got %+v", frontends)
+	}
+}
+
+func TestFrontendSticky(t *testing.T) {
+	pool := backend.NewPool()
+	_, _ = pool.AddBackend("10.0.0.1:8080", 1)
+	sticky := balancer.NewStickyBalancer(balancer.NewRoundRobinBalancer(pool), pool, time.Minute, 10)
+	_, _ = sticky.Pick("192.168.1.1")
+	_, _ = sticky.Pick("192.168.1.2")
+
+	h := NewHandler(pool)
+	h.AddFrontend("web", pool)
+	h.AddSticky("web", "default", sticky)
+	server := httptest.NewServer(Routes(h))
+	defer server.Close()
+
+	entries := func() []StickyEntry {
+		resp, err := http.Get(server.URL + "/frontends/web/sticky")
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var entries []StickyEntry
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return entries
+	}
+	del := func(path string) int {
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	got := entries()
+	if len(got) != 2 || got[0].Key != "192.168.1.2" || got[0].Pool != "default" || got[0].Backend != "10.0.0.1:8080" {
+		t.Errorf("Expected 2 entries with 192.168.1.2 first, got %+v", got)
+	}
+
+	if code := del("/frontends/web/sticky/192.168.1.1"); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+	if code := del("/frontends/web/sticky/192.168.1.1"); code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", code)
+	}
+	if got := entries(); len(got) != 1 {
+		t.Errorf("Expected 1 entry, got %+v", got)
+	}
+
+	if code := del("/frontends/web/sticky"); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+	if got := entries(); len(got) != 0 {
+		t.Errorf("Expected no entries after flush, got %+v", got)
+	}
+
+	resp, err := http.Get(server.URL + "/frontends/api/sticky")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestBackendLimits(t *testing.T) {
+	pool := backend.NewPool()
+	b, _ := pool.AddBackend("10.0.0.6:8080", 1)
+	api := backend.NewPool()
+	_, _ = api.AddBackend("10.0.1.6:9090", 1)
+
+	h := NewHandler(pool)
+	h.AddFrontend("api", api)
+	server := httptest.NewServer(Routes(h))
+	defer server.Close()
+
+	put := func(path string, limits Limits) (int, Limits) {
+		body, _ := json.Marshal(limits)
+		req, _ := http.NewRequest(http.MethodPut, server.URL+path, bytes.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to make request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var got Limits
+		_ = json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+
+	code, got := put("/backends/10.0.0.6:8080/limits", Limits{MaxConnections: 1, MaxConnectsPerSec: 50})
+	if code != http.StatusOK || got != (Limits{MaxConnections: 1, MaxConnectsPerSec: 50}) {
+		t.Errorf("Expected status 200 with the new limits, got %d %+v", code, got)
+	}
+	if b.Limits().MaxConnections != 1 {
+		t.Errorf("Expected max connections 1, got %d", b.Limits().MaxConnections)
+	}
+	if code, _ := put("/backends/10.0.0.6:8080/limits", Limits{MaxPending: -1}); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative limits, got %d", code)
+	}
+	if code, _ := put("/frontends/api/backends/10.0.1.6:9090/limits", Limits{MaxPending: 2}); code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if code, _ := put("/frontends/api/backends/10.0.0.6:8080/limits", Limits{MaxPending: 2}); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a backend of another frontend, got %d", code)
+	}
+
+	// Picks refused at the limit show up as overflows
+	b.IncConn()
+	if _, err := balancer.NewRoundRobinBalancer(pool).Pick(""); err == nil {
+		t.Fatal("Expected the pick to be refused")
+	}
+	resp, err := http.Get(server.URL + "/backends/10.0.0.6:8080")
+	if err != nil {
+		t.Fatalf("Failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var out Backend
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if out.Limits.MaxConnections != 1 || out.Overflow.MaxConnections != 1 {
+		t.Errorf("Expected limit 1 and 1 overflow, got %+v and %+v", out.Limits, out.Overflow)
+	}
+}
@@ -2,18 +2,109 @@ package api
 
 import (
 	"LoadBalancer/internal/backend"
+	"LoadBalancer/internal/balancer"
 	"encoding/json"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 )
 
 type Handler struct {
+	// Pool served at /backends, the first frontend's
 	pool *backend.Pool
+
+	frontends map[string]*backend.Pool
+	names     []string // frontend names in registration order
+
+	pools map[string]map[string]*backend.Pool // by frontend, then pool name
+
+	sticky map[string][]stickyTable // session tables by frontend name
+}
+
+type stickyTable struct {
+	pool  string
+	table *balancer.Sticky
 }
 
 func NewHandler(pool *backend.Pool) *Handler {
 	return &Handler{
-		pool: pool,
+		pool:      pool,
+		frontends: make(map[string]*backend.Pool),
+		pools:     make(map[string]map[string]*backend.Pool),
+		sticky:    make(map[string][]stickyTable),
+	}
+}
+
+// AddFrontend exposes pool under /frontends/{name}/backends.
+func (h *Handler) AddFrontend(name string, pool *backend.Pool) {
+	if _, ok := h.frontends[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.frontends[name] = pool
+}
+
+// AddPool exposes one of the frontend's pools under
+// /frontends/{name}/pools/{pool}/backends.
+func (h *Handler) AddPool(frontend, name string, pool *backend.Pool) {
+	if h.pools[frontend] == nil {
+		h.pools[frontend] = make(map[string]*backend.Pool)
+	}
+	h.pools[frontend][name] = pool
+}
+
+// AddSticky exposes the session table of the frontend's pool under
+// /frontends/{name}/sticky.
+func (h *Handler) AddSticky(frontend, pool string, table *balancer.Sticky) {
+	h.sticky[frontend] = append(h.sticky[frontend], stickyTable{pool: pool, table: table})
+}
+
+func toBackend(b *backend.Backend) Backend {
+	out := Backend{
+		Address:         b.Address,
+		Weight:          b.GetWeight(),
+		EffectiveWeight: b.EffectiveWeight(),
+		Priority:        b.Priority(),
+		Alive:           b.IsAlive(),
+		Ejected:         b.IsEjected(),
+		ConnCount:       b.ConnCount(),
+		BytesSent:       b.BytesSent(),
+		BytesReceived:   b.BytesReceived(),
+		Retries:         b.Retries(),
+		Limits:          toLimits(b.Limits()),
+	}
+	overflows := b.Overflows()
+	out.Overflow = Overflow{
+		MaxConnections:    overflows.Connections,
+		MaxPending:        overflows.Pending,
+		MaxConnectsPerSec: overflows.ConnectRate,
+	}
+	for code, n := range b.GRPCStatus() {
+		if n == 0 {
+			continue
+		}
+		if out.GRPCStatus == nil {
+			out.GRPCStatus = make(map[string]int64)
+		}
+		out.GRPCStatus[grpcCodeNames[code]] = n
+	}
+	return out
+}
+
+func toBackends(pool *backend.Pool) []Backend {
+	backends := pool.GetBackends()
+	out := make([]Backend, 0, len(backends))
+	for _, b := range backends {
+		out = append(out, toBackend(b))
+	}
+	return out
+}
+
+func toLimits(l backend.Limits) Limits {
+	return Limits{
+		MaxConnections:    l.MaxConnections,
+		MaxPending:        l.MaxPending,
+		MaxConnectsPerSec: l.MaxConnectsPerSec,
 	}
 }
 
@@ -23,20 +114,108 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetBackends(w http.ResponseWriter, r *http.Request) {
+	h.serveBackends(w, r, h.pool)
+}
+
+func (h *Handler) BackendByAddress(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/backends/")
+	if address, ok := strings.CutSuffix(address, "/limits"); ok {
+		h.serveLimits(w, r, h.pool, address)
+		return
+	}
+	h.serveBackend(w, r, h.pool, address)
+}
+
+func (h *Handler) GetFrontends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := make([]Frontend, 0, len(h.names))
+	for _, name := range h.names {
+		f := Frontend{Name: name, Backends: toBackends(h.frontends[name])}
+		for _, poolName := range slices.Sorted(maps.Keys(h.pools[name])) {
+			f.Pools = append(f.Pools, Pool{Name: poolName, Backends: toBackends(h.pools[name][poolName])})
+		}
+		response = append(response, f)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) FrontendBackends(w http.ResponseWriter, r *http.Request) {
+	pool, ok := h.frontends[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "Frontend not found", http.StatusNotFound)
+		return
+	}
+	h.serveBackends(w, r, pool)
+}
+
+func (h *Handler) FrontendBackendByAddress(w http.ResponseWriter, r *http.Request) {
+	pool, ok := h.frontends[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "Frontend not found", http.StatusNotFound)
+		return
+	}
+	h.serveBackend(w, r, pool, r.PathValue("address"))
+}
+
+func (h *Handler) FrontendBackendLimits(w http.ResponseWriter, r *http.Request) {
+	pool, ok := h.frontends[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "Frontend not found", http.StatusNotFound)
+		return
+	}
+	h.serveLimits(w, r, pool, r.PathValue("address"))
+}
+
+func (h *Handler) PoolBackends(w http.ResponseWriter, r *http.Request) {
+	pool, ok := h.namedPool(w, r)
+	if !ok {
+		return
+	}
+	h.serveBackends(w, r, pool)
+}
+
+func (h *Handler) PoolBackendByAddress(w http.ResponseWriter, r *http.Request) {
+	pool, ok := h.namedPool(w, r)
+	if !ok {
+		return
+	}
+	h.serveBackend(w, r, pool, r.PathValue("address"))
+}
+
+func (h *Handler) PoolBackendLimits(w http.ResponseWriter, r *http.Request) {
+	pool, ok := h.namedPool(w, r)
+	if !ok {
+		return
+	}
+	h.serveLimits(w, r, pool, r.PathValue("address"))
+}
+
+// namedPool looks up the {name} frontend's {pool} pool, answering 404 when
+// either is unknown.
+func (h *Handler) namedPool(w http.ResponseWriter, r *http.Request) (*backend.Pool, bool) {
+	pools, ok := h.pools[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "Frontend not found", http.StatusNotFound)
+		return nil, false
+	}
+	pool, ok := pools[r.PathValue("pool")]
+	if !ok {
+		http.Error(w, "Pool not found", http.StatusNotFound)
+		return nil, false
+	}
+	return pool, true
+}
+
+func (h *Handler) serveBackends(w http.ResponseWriter, r *http.Request, pool *backend.Pool) {
 	switch r.Method {
 	case http.MethodGet:
-		backends := h.pool.GetBackends()
-		response := make([]Backend, 0, len(backends))
-		for _, b := range backends {
-			response = append(response, Backend{
-				Address:   b.Address,
-				Weight:    b.GetWeight(),
-				Alive:     b.IsAlive(),
-				ConnCount: b.ConnCount(),
-			})
-		}
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(response)
+		_ = json.NewEncoder(w).Encode(toBackends(pool))
 
 	case http.MethodPost:
 		var req AddBackendRequest
@@ -45,7 +224,12 @@ func (h *Handler) GetBackends(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		b, err := h.pool.AddBackend(req.Address, req.Weight)
+		if req.Priority < 0 {
+			http.Error(w, "priority cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		b, err := pool.AddBackend(req.Address, req.Weight, backend.WithPriority(req.Priority))
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
@@ -53,20 +237,14 @@ func (h *Handler) GetBackends(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		_ = json.NewEncoder(w).Encode(Backend{
-			Address:   b.Address,
-			Weight:    b.GetWeight(),
-			Alive:     b.IsAlive(),
-			ConnCount: b.ConnCount(),
-		})
+		_ = json.NewEncoder(w).Encode(toBackend(b))
 
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func (h *Handler) BackendByAddress(w http.ResponseWriter, r *http.Request) {
-	address := strings.TrimPrefix(r.URL.Path, "/backends/")
+func (h *Handler) serveBackend(w http.ResponseWriter, r *http.Request, pool *backend.Pool, address string) {
 	if address == "" {
 		http.Error(w, "Backend address is required", http.StatusBadRequest)
 		return
@@ -74,19 +252,14 @@ func (h *Handler) BackendByAddress(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		b, err := h.pool.GetBackend(address)
+		b, err := pool.GetBackend(address)
 		if err != nil {
 			http.Error(w, "Backend not found", http.StatusNotFound)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(Backend{
-			Address:   b.Address,
-			Weight:    b.GetWeight(),
-			Alive:     b.IsAlive(),
-			ConnCount: b.ConnCount(),
-		})
+		_ = json.NewEncoder(w).Encode(toBackend(b))
 
 	case http.MethodPut:
 		var req UpdateWeightRequest
@@ -95,14 +268,14 @@ func (h *Handler) BackendByAddress(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := h.pool.UpdateWeight(address, req.Weight); err != nil {
+		if err := pool.UpdateWeight(address, req.Weight); err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 
 	case http.MethodDelete:
-		if !h.pool.RemoveBackend(address) {
+		if !pool.RemoveBackend(address) {
 			http.Error(w, "Backend not found", http.StatusNotFound)
 			return
 		}
@@ -112,3 +285,95 @@ func (h *Handler) BackendByAddress(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+func (h *Handler) FrontendSticky(w http.ResponseWriter, r *http.Request) {
+	tables, ok := h.sticky[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "Sticky sessions not enabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		response := []StickyEntry{}
+		for _, t := range tables {
+			for _, e := range t.table.Entries() {
+				response = append(response, StickyEntry{
+					Pool:      t.pool,
+					Key:       e.Key,
+					Backend:   e.Backend,
+					ExpiresAt: e.ExpiresAt,
+				})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+
+	case http.MethodDelete:
+		for _, t := range tables {
+			t.table.Flush()
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) FrontendStickyByKey(w http.ResponseWriter, r *http.Request) {
+	tables, ok := h.sticky[r.PathValue("name")]
+	if !ok {
+		http.Error(w, "Sticky sessions not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	removed := false
+	for _, t := range tables {
+		if t.table.Remove(r.PathValue("key")) {
+			removed = true
+		}
+	}
+	if !removed {
+		http.Error(w, "Sticky entry not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) serveLimits(w http.ResponseWriter, r *http.Request, pool *backend.Pool, address string) {
+	b, err := pool.GetBackend(address)
+	if err != nil {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req Limits
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.MaxConnections < 0 || req.MaxPending < 0 || req.MaxConnectsPerSec < 0 {
+			http.Error(w, "limits must not be negative", http.StatusBadRequest)
+			return
+		}
+		b.SetLimits(backend.Limits{
+			MaxConnections:    req.MaxConnections,
+			MaxPending:        req.MaxPending,
+			MaxConnectsPerSec: req.MaxConnectsPerSec,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(toLimits(b.Limits()))
+}
@@ -8,6 +8,15 @@ func Routes(h *Handler) http.Handler {
 	mux.HandleFunc("/health", h.HealthCheck)
 	mux.HandleFunc("/backends", h.GetBackends)
 	mux.HandleFunc("/backends/", h.BackendByAddress)
+	mux.HandleFunc("/frontends", h.GetFrontends)
+	mux.HandleFunc("/frontends/{name}/backends", h.FrontendBackends)
+	mux.HandleFunc("/frontends/{name}/backends/{address}", h.FrontendBackendByAddress)
+	mux.HandleFunc("/frontends/{name}/backends/{address}/limits", h.FrontendBackendLimits)
+	mux.HandleFunc("/frontends/{name}/pools/{pool}/backends", h.PoolBackends)
+	mux.HandleFunc("/frontends/{name}/pools/{pool}/backends/{address}", h.PoolBackendByAddress)
+	mux.HandleFunc("/frontends/{name}/pools/{pool}/backends/{address}/limits", h.PoolBackendLimits)
+	mux.HandleFunc("/frontends/{name}/sticky", h.FrontendSticky)
+	mux.HandleFunc("/frontends/{name}/sticky/{key...}", h.FrontendStickyByKey)
 
 	var handler http.Handler = mux
 	handler = LoggingMiddleware(handler)
@@ -1,15 +1,73 @@
 package api
 
+import "time"
+
 type Backend struct {
-	Address   string `json:"address"`
-	Weight    int64  `json:"weight"`
-	Alive     bool   `json:"alive"`
-	ConnCount int64  `json:"conn_count"`
+	Address         string   `json:"address"`
+	Weight          int64    `json:"weight"`
+	EffectiveWeight float64  `json:"effective_weight"`
+	Priority        int      `json:"priority"`
+	Alive           bool     `json:"alive"`
+	Ejected         bool     `json:"ejected"`
+	ConnCount       int64    `json:"conn_count"`
+	BytesSent       int64    `json:"bytes_sent"`
+	BytesReceived   int64    `json:"bytes_received"`
+	Retries         int64    `json:"retries"`
+	Limits          Limits   `json:"limits"`
+	Overflow        Overflow `json:"overflow"`
+
+	// Completed gRPC calls by grpc-status name, only codes seen so far
+	GRPCStatus map[string]int64 `json:"grpc_status,omitempty"`
+}
+
+// grpcCodeNames are the canonical gRPC status names, indexed by code.
+var grpcCodeNames = [...]string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED",
+	"NOT_FOUND", "ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED",
+	"INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+// Limits are a backend's circuit breaker thresholds, 0 = unlimited.
+type Limits struct {
+	MaxConnections    int64 `json:"max_connections"`
+	MaxPending        int64 `json:"max_pending"`
+	MaxConnectsPerSec int64 `json:"max_connects_per_sec"`
+}
+
+// Overflow counts the times a backend was skipped for each circuit
+// breaker limit.
+type Overflow struct {
+	MaxConnections    int64 `json:"max_connections"`
+	MaxPending        int64 `json:"max_pending"`
+	MaxConnectsPerSec int64 `json:"max_connects_per_sec"`
+}
+
+type Frontend struct {
+	Name     string    `json:"name"`
+	Backends []Backend `json:"backends"`
+	Pools    []Pool    `json:"pools,omitempty"`
+}
+
+// Pool is one of a frontend's pools, the default one included.
+type Pool struct {
+	Name     string    `json:"name"`
+	Backends []Backend `json:"backends"`
+}
+
+// StickyEntry is a client key pinned to a backend of one of a frontend's
+// pools.
+type StickyEntry struct {
+	Pool      string    `json:"pool"`
+	Key       string    `json:"key"`
+	Backend   string    `json:"backend"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 type AddBackendRequest struct {
-	Address string `json:"address"`
-	Weight  int64  `json:"weight"`
+	Address  string `json:"address"`
+	Weight   int64  `json:"weight"`
+	Priority int    `json:"priority"`
 }
 
 type UpdateWeightRequest struct {
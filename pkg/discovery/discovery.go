@@ -13,6 +13,8 @@ type Event struct {
 	Type    EventType
 	Address string
 	Weight  int64
+	// PROXY protocol version to send to this backend, empty = frontend default
+	ProxyProtocol string
 }
 
 type Discover interface {
@@ -2,6 +2,7 @@ package docker
 
 import (
 	"LoadBalancer/internal/logging"
+	"LoadBalancer/internal/proxyproto"
 	"LoadBalancer/pkg/discovery"
 	"context"
 	"fmt"
@@ -16,11 +17,13 @@ import (
 
 type dockerDiscover struct {
 	client *client.Client
+	// Value of the lb.frontend label to match, empty matches any container
+	frontend string
 	// Map container ID to Address (host:port) to handle removals
 	containers map[string]string
 }
 
-func NewDockerDiscover() *dockerDiscover {
+func NewDockerDiscover(frontend string) *dockerDiscover {
 	// Initialize client with environment variables and version negotiation
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
@@ -29,10 +32,19 @@ func NewDockerDiscover() *dockerDiscover {
 	}
 	return &dockerDiscover{
 		client:     cli,
+		frontend:   frontend,
 		containers: make(map[string]string),
 	}
 }
 
+func (d *dockerDiscover) labelFilters() filters.Args {
+	args := filters.NewArgs(filters.Arg("label", "lb.enable=true"))
+	if d.frontend != "" {
+		args.Add("label", "lb.frontend="+d.frontend)
+	}
+	return args
+}
+
 func (d *dockerDiscover) Run(ctx context.Context, apiEvents chan<- discovery.Event) error {
 	if d.client == nil {
 		return fmt.Errorf("docker client not initialized")
@@ -42,7 +54,7 @@ func (d *dockerDiscover) Run(ctx context.Context, apiEvents chan<- discovery.Eve
 
 	// 1. Initial Sync: List existing containers
 	containers, err := d.client.ContainerList(ctx, container.ListOptions{
-		Filters: filters.NewArgs(filters.Arg("label", "lb.enable=true")),
+		Filters: d.labelFilters(),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to list existing containers: %w", err)
@@ -53,9 +65,8 @@ func (d *dockerDiscover) Run(ctx context.Context, apiEvents chan<- discovery.Eve
 	}
 
 	// 2. Event Watch Loop
-	eventFilters := filters.NewArgs()
+	eventFilters := d.labelFilters()
 	eventFilters.Add("type", "container")
-	eventFilters.Add("label", "lb.enable=true")
 	eventFilters.Add("event", "start")
 	eventFilters.Add("event", "die")
 	eventFilters.Add("event", "pause")
@@ -126,14 +137,22 @@ func (d *dockerDiscover) handleAdd(ctx context.Context, containerID string, apiE
 		}
 	}
 
+	// Extract PROXY protocol version, empty uses the frontend default
+	sendProxy := info.Config.Labels["lb.send-proxy"]
+	if !proxyproto.ValidVersion(sendProxy) {
+		logging.L().Warn("Ignoring invalid lb.send-proxy label", zap.String("name", info.Name), zap.String("value", sendProxy))
+		sendProxy = ""
+	}
+
 	// Update State
 	d.containers[containerID] = address
 
 	logging.L().Info("Discovered backend", zap.String("address", address), zap.Int64("weight", weight))
 	apiEvents <- discovery.Event{
-		Type:    discovery.BackendAdd,
-		Address: address,
-		Weight:  weight,
+		Type:          discovery.BackendAdd,
+		Address:       address,
+		Weight:        weight,
+		ProxyProtocol: sendProxy,
 	}
 }
 
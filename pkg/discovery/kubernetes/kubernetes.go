@@ -2,6 +2,7 @@ package kubernetes
 
 import (
 	"LoadBalancer/internal/logging"
+	"LoadBalancer/internal/proxyproto"
 	"LoadBalancer/pkg/discovery"
 	"context"
 	"fmt"
@@ -17,10 +18,14 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// Service annotation selecting the PROXY protocol version sent to its pods
+const sendProxyAnnotation = "gobalancer.io/send-proxy"
+
 type kubernetesDiscover struct {
 	clientset kubernetes.Interface
 	namespace string
 	service   string
+	sendProxy string
 }
 
 func NewKubernetesDiscover(namespace, service string) *kubernetesDiscover {
@@ -57,6 +62,18 @@ func (k *kubernetesDiscover) Run(ctx context.Context, eventsChan chan<- discover
 
 	logging.L().Info("Starting Kubernetes discovery", zap.String("namespace", k.namespace), zap.String("service", k.service))
 
+	// Per-service settings live in annotations on the Service itself
+	svc, err := k.clientset.CoreV1().Services(k.namespace).Get(ctx, k.service, metav1.GetOptions{})
+	if err != nil {
+		logging.L().Warn("Failed to read service annotations", zap.String("service", k.service), zap.Error(err))
+	} else {
+		k.sendProxy = svc.Annotations[sendProxyAnnotation]
+		if !proxyproto.ValidVersion(k.sendProxy) {
+			logging.L().Warn("Ignoring invalid send-proxy annotation", zap.String("service", k.service), zap.String("value", k.sendProxy))
+			k.sendProxy = ""
+		}
+	}
+
 	// Watch EndpointSlices for the service
 	labelSelector := fmt.Sprintf("kubernetes.io/service-name=%s", k.service)
 	watcher, err := k.clientset.DiscoveryV1().EndpointSlices(k.namespace).Watch(ctx, metav1.ListOptions{
@@ -139,9 +156,10 @@ func (k *kubernetesDiscover) handleEndpointSlice(slice *discoveryv1.EndpointSlic
 		)
 
 		eventsChan <- discovery.Event{
-			Type:    discoType,
-			Address: address,
-			Weight:  weight,
+			Type:          discoType,
+			Address:       address,
+			Weight:        weight,
+			ProxyProtocol: k.sendProxy,
 		}
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
@@ -127,3 +128,70 @@ func TestKubernetesDiscover_Run(t *testing.T) {
 		t.Fatal("Timeout waiting for delete event")
 	}
 }
+
+func TestKubernetesDiscover_SendProxyAnnotation(t *testing.T) {
+	tests := []struct {
+		annotation string
+		expected   string
+	}{
+		{"v2", "v2"},
+		{"none", "none"},
+		// Invalid values are dropped so the frontend default applies
+		{"v3", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.annotation, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "my-service",
+					Namespace:   "default",
+					Annotations: map[string]string{sendProxyAnnotation: tt.annotation},
+				},
+			})
+			k := &kubernetesDiscover{
+				clientset: clientset,
+				namespace: "default",
+				service:   "my-service",
+			}
+
+			eventsChan := make(chan discovery.Event, 10)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = k.Run(ctx, eventsChan) }()
+
+			// Allow watcher to start
+			time.Sleep(100 * time.Millisecond)
+
+			slice := &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "my-service-slice-1",
+					Namespace: "default",
+					Labels: map[string]string{
+						"kubernetes.io/service-name": "my-service",
+					},
+				},
+				AddressType: discoveryv1.AddressTypeIPv4,
+				Endpoints: []discoveryv1.Endpoint{
+					{
+						Addresses:  []string{"10.0.0.1"},
+						Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)},
+					},
+				},
+				Ports: []discoveryv1.EndpointPort{{Port: ptr.To(int32(8080))}},
+			}
+			if _, err := clientset.DiscoveryV1().EndpointSlices("default").Create(ctx, slice, metav1.CreateOptions{}); err != nil {
+				t.Fatalf("Failed to create EndpointSlice: %v", err)
+			}
+
+			select {
+			case event := <-eventsChan:
+				if event.ProxyProtocol != tt.expected {
+					t.Errorf("Expected proxy protocol %q, got %q", tt.expected, event.ProxyProtocol)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Timeout waiting for event")
+			}
+		})
+	}
+}